@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/cli"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/storage"
+)
+
+// runDiff выполняет команду diff: сравнивает граф на моменты окончания двух запусков
+// и выводит отчёт в stdout таблицей или в JSON.
+func runDiff(ctx context.Context, s *storage.Neo4jStorage, args *cli.Args) error {
+	diff, err := s.Diff(ctx, args.DiffFrom, args.DiffTo)
+	if err != nil {
+		return fmt.Errorf("diff: %v", err)
+	}
+	if args.Format == cli.FormatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	return printDiff(os.Stdout, diff)
+}
+
+// printDiff выводит отчёт diff таблицей: сводку и по разделу на каждый вид изменений.
+func printDiff(out io.Writer, diff *models.GraphDiff) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "From:\t%s\t%s\n", diff.From.ID, diff.From.FinishedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "To:\t%s\t%s\n", diff.To.ID, diff.To.FinishedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "\nNodes:\t+%d\t-%d\t~%d\n", len(diff.AddedNodes), len(diff.RemovedNodes), len(diff.ChangedNodes))
+	fmt.Fprintf(w, "Edges:\t+%d\t-%d\t\n", len(diff.AddedEdges), len(diff.RemovedEdges))
+
+	printNodes := func(title string, nodes []models.NodeDiff) {
+		if len(nodes) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s\nLABEL\tID\tNAME\n", title)
+		for _, node := range nodes {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", node.Label, node.ID, node.Name)
+		}
+	}
+	printEdges := func(title string, edges []models.EdgeDiff) {
+		if len(edges) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s\nTYPE\tFROM\tTO\n", title)
+		for _, edge := range edges {
+			fmt.Fprintf(w, "%s\t%s:%d\t%s:%d\n", edge.Type, edge.FromLabel, edge.FromID, edge.ToLabel, edge.ToID)
+		}
+	}
+
+	printNodes("Added nodes", diff.AddedNodes)
+	printNodes("Removed nodes", diff.RemovedNodes)
+	if len(diff.ChangedNodes) > 0 {
+		fmt.Fprintf(w, "\nChanged nodes\nLABEL\tID\tPROPERTY\tOLD\tNEW\tCHANGED AT\n")
+		for _, change := range diff.ChangedNodes {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%v\t%v\t%s\n", change.Label, change.ID, change.Property,
+				valueOrDash(change.Old), valueOrDash(change.New), change.ChangedAt.Format(time.RFC3339))
+		}
+	}
+	printEdges("Added edges", diff.AddedEdges)
+	printEdges("Removed edges", diff.RemovedEdges)
+	return w.Flush()
+}
+
+// valueOrDash заменяет отсутствующее значение прочерком.
+func valueOrDash(value any) any {
+	if value == nil || value == "" {
+		return "-"
+	}
+	return value
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/app"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/checkpoint"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/cli"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/clients"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/config"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/logger"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/storage"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -16,19 +19,39 @@ import (
 )
 
 func main() {
+	args := cli.ParseArgs()
+
+	logger.Setup(args.LogLevel, args.LogFile)
+
+	// Каталогу запросов не нужны ни VK, ни Neo4j.
+	if args.Command == cli.CommandQueries {
+		if err := runQueries(os.Stdout, args); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
 	err := godotenv.Load(config.DefaultEnvFile)
 	if err != nil {
 		logrus.Fatalf("load env: %v", err)
 	}
 
-	userID, logLevel, logFile, query := cli.ParseArgs()
-
-	logger.Setup(logLevel, logFile)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	vkClient := clients.NewVKClient(os.Getenv("VK_ACCESS_TOKEN"))
+	vkClient := clients.NewVKClient(ctx, os.Getenv("VK_ACCESS_TOKEN"))
+	vkClient.SetRateLimit(args.VKRequestsPerSecond)
+	vkClient.MaxRetries = args.VKMaxRetries
+	vkClient.BatchWindow = args.VKBatchWindow
+
+	var checkpointer *checkpoint.Checkpointer
+	if args.StateDir != "" {
+		checkpointer, err = checkpoint.New(args.StateDir, args.CheckpointInterval)
+		if err != nil {
+			logrus.Fatalf("Не удалось подготовить каталог состояния: %v", err)
+		}
+		vkClient.Checkpointer = checkpointer
+	}
 	neo4jStorage := storage.NewNeo4jStorage(
 		os.Getenv("NEO4J_URI"),
 		os.Getenv("NEO4J_USER"),
@@ -38,6 +61,9 @@ func main() {
 		logrus.Fatalf("Не удалось подключиться к Neo4j: %v", err)
 	}
 	logrus.Info("Подключение к Neo4j успешно установлено")
+	neo4jStorage.BatchSize = args.BatchSize
+	neo4jStorage.FlushInterval = args.FlushInterval
+	neo4jStorage.Queries = args.Queries
 	defer func(neo4jStorage *storage.Neo4jStorage, ctx context.Context) {
 		err := neo4jStorage.Close(ctx)
 		if err != nil {
@@ -45,6 +71,28 @@ func main() {
 		}
 	}(neo4jStorage, ctx)
 
+	if args.Command == cli.CommandMigrate {
+		if err := runMigrate(ctx, neo4jStorage, args.CommandArgs[0]); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
+	applied, err := neo4jStorage.Migrate(ctx)
+	if err != nil {
+		logrus.Fatalf("Не удалось применить миграции схемы Neo4j: %v", err)
+	}
+	if len(applied) > 0 {
+		logrus.Infof("Применено миграций схемы: %d", len(applied))
+	}
+
+	if args.Command == cli.CommandDiff {
+		if err := runDiff(ctx, neo4jStorage, args); err != nil {
+			logrus.Fatal(err)
+		}
+		return
+	}
+
 	myApp := app.NewApp(vkClient, neo4jStorage)
 
 	sigChan := make(chan os.Signal, 1)
@@ -53,22 +101,117 @@ func main() {
 	go func() {
 		sig := <-sigChan
 		logrus.Infof("Получен сигнал: %s. Завершение работы...", sig)
+		if checkpointer != nil {
+			if err := checkpointer.Flush(); err != nil {
+				logrus.Warningf("Не удалось сохранить состояние обхода: %v", err)
+			} else {
+				logrus.Info("Состояние обхода сохранено, продолжить можно с флагом -resume")
+			}
+		}
 		cancel()
 	}()
 
-	if userID == "self" {
-		resolvedID, err := vkClient.GetCurrentUserID(ctx)
+	seeds := resolveSeeds(ctx, vkClient, args)
+
+	if err := myApp.Run(ctx, seeds, args.Crawl, args.Query, args.QueryParams); err != nil {
+		logrus.Fatal(err)
+	}
+
+	logrus.Info("Программа завершена успешно.")
+}
+
+// resolveSeeds определяет пользователей и группы, с которых начинается обход, и логирует их.
+// Повторяющиеся исходные узлы отбрасываются.
+func resolveSeeds(ctx context.Context, vkClient *clients.VKClient, args *cli.Args) []models.NodeRef {
+	// kind пуст для seeds_file: там допустимы и пользователи, и группы.
+	type input struct {
+		value string
+		flag  string
+		kind  models.NodeKind
+	}
+	var inputs []input
+	for _, value := range args.UserIDs {
+		inputs = append(inputs, input{value, "user_id", models.NodeUser})
+	}
+	for _, value := range args.GroupIDs {
+		inputs = append(inputs, input{value, "group_id", models.NodeGroup})
+	}
+	for _, value := range args.SeedIDs {
+		inputs = append(inputs, input{value, "seeds_file", ""})
+	}
+
+	var seeds []models.NodeRef
+	seen := make(map[models.NodeRef]bool)
+	for _, in := range inputs {
+		var seed models.NodeRef
+		var err error
+		if in.kind == "" {
+			seed, err = vkClient.ResolveSeed(ctx, in.value, models.NodeUser)
+		} else {
+			seed, err = vkClient.ResolveSeedOf(ctx, in.value, in.kind)
+		}
+		if err != nil {
+			logrus.Fatalf("Не удалось определить исходный узел %s из -%s: %v", in.value, in.flag, err)
+		}
+		if seen[seed] {
+			logrus.Warningf("Исходный узел %s указан повторно (%s)", seed, in.value)
+			continue
+		}
+		seen[seed] = true
+
+		name, err := vkClient.DescribeSeed(ctx, seed)
 		if err != nil {
-			logrus.Fatalf("Ошибка получения текущего userID: %v", err)
+			logrus.Fatalf("Ошибка получения данных %s: %v", seed, err)
 		}
-		userID = resolvedID
+		logrus.WithFields(logrus.Fields{
+			"input": in.value,
+			"kind":  seed.Kind,
+			"id":    seed.ID,
+			"name":  name,
+		}).Info("Resolved seed")
+		seeds = append(seeds, seed)
 	}
+	return seeds
+}
 
-	logrus.Infof("Resolved user ID: %s", userID)
+// runMigrate выполняет команду migrate: up применяет миграции, status показывает
+// версию схемы и ожидающие миграции, dry-run — запросы, которые будут выполнены.
+func runMigrate(ctx context.Context, s *storage.Neo4jStorage, mode string) error {
+	if mode == cli.MigrateUp {
+		applied, err := s.Migrate(ctx)
+		if err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+		logrus.Infof("Применено миграций: %d", len(applied))
+		return nil
+	}
 
-	if err := myApp.Run(ctx, userID, 2, query); err != nil {
-		logrus.Fatal(err)
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("schema version: %w", err)
 	}
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("pending migrations: %w", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"current": version,
+		"latest":  storage.LatestSchemaVersion(),
+		"pending": len(pending),
+	}).Info("Состояние схемы Neo4j")
 
-	logrus.Info("Программа завершена успешно.")
+	for _, m := range pending {
+		entry := logrus.WithFields(logrus.Fields{
+			"version":     m.Version,
+			"description": m.Description,
+		})
+		if mode != cli.MigrateDryRun {
+			entry.Info("Миграция ожидает применения")
+			continue
+		}
+		for _, statement := range m.Statements {
+			entry.WithField("statement", statement).Info("Будет выполнено")
+		}
+	}
+	return nil
 }
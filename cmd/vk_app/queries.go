@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/cli"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/queries"
+)
+
+// runQueries выполняет команду queries: list выводит каталог запросов,
+// describe — описание, параметры, столбцы и текст одного запроса.
+func runQueries(out io.Writer, args *cli.Args) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if args.CommandArgs[0] == cli.QueriesList {
+		fmt.Fprintln(w, "NAME\tPARAMS\tDESCRIPTION")
+		for _, query := range args.Queries.List() {
+			names := make([]string, len(query.Params))
+			for i, param := range query.Params {
+				names[i] = param.Name
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", query.Name, valueOrDash(strings.Join(names, ",")), query.Description)
+		}
+		return w.Flush()
+	}
+
+	name := args.CommandArgs[1]
+	query, ok := args.Queries.Get(name)
+	if !ok {
+		return fmt.Errorf("query %s not found", name)
+	}
+	describeQuery(w, query)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Текст запроса выводится мимо tabwriter: табуляция в нём — отступы, а не столбцы.
+	_, err := fmt.Fprintf(out, "\n%s\n", query.Cypher)
+	return err
+}
+
+// describeQuery выводит описание, параметры и столбцы результата запроса.
+func describeQuery(w io.Writer, query queries.Query) {
+	fmt.Fprintf(w, "Name:\t%s\n", query.Name)
+	fmt.Fprintf(w, "Description:\t%s\n", query.Description)
+	fmt.Fprintf(w, "Source:\t%s\n", query.Source)
+	fmt.Fprintf(w, "Columns:\t%s\n", valueOrDash(strings.Join(query.Columns, ", ")))
+	if len(query.Params) > 0 {
+		fmt.Fprintln(w, "\nPARAM\tTYPE\tDEFAULT\tDESCRIPTION")
+		for _, param := range query.Params {
+			defaultValue := param.Default
+			if defaultValue == "" {
+				defaultValue = "required"
+			}
+			paramType := string(param.Type)
+			if param.Min != nil {
+				paramType += " >= " + strconv.FormatFloat(*param.Min, 'f', -1, 64)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", param.Name, paramType, defaultValue, param.Description)
+		}
+	}
+}
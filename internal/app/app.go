@@ -2,18 +2,27 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
+// finishRunTimeout ограничивает запись итога запуска, в том числе после отмены сбора.
+const finishRunTimeout = time.Minute
+
 type Storage interface {
-	SaveData(ctx context.Context, data *models.Data) error
-	RunQuery(ctx context.Context, queryName string) ([]map[string]interface{}, error)
+	NewStreamWriter(ctx context.Context, runID string) models.StreamWriter
+	StartRun(ctx context.Context, run models.CrawlRun) error
+	FinishRun(ctx context.Context, run models.CrawlRun) error
+	RunQuery(ctx context.Context, queryName string, params map[string]string) ([]map[string]interface{}, error)
 }
 
 type VkApi interface {
-	CollectData(ctx context.Context, userID string, depth int) (*models.Data, error)
+	CollectData(ctx context.Context, seeds []models.NodeRef, opts models.CrawlOptions, sink models.Sink) (models.CrawlStats, error)
 }
 
 type App struct {
@@ -25,10 +34,11 @@ func NewApp(api VkApi, storage Storage) *App {
 	return &App{api, storage}
 }
 
-func (a *App) Run(ctx context.Context, userID string, depth int, query string) error {
+// Run выполняет запрос query с параметрами params или, если запрос не указан, собирает данные.
+func (a *App) Run(ctx context.Context, seeds []models.NodeRef, opts models.CrawlOptions, query string, params map[string]string) error {
 	if query != "" {
-		logrus.Infof("Run query: %s", query)
-		results, err := a.storage.RunQuery(ctx, query)
+		logrus.WithField("params", params).Infof("Run query: %s", query)
+		results, err := a.storage.RunQuery(ctx, query, params)
 		if err != nil {
 			return fmt.Errorf("run query: %v", err)
 		}
@@ -37,15 +47,79 @@ func (a *App) Run(ctx context.Context, userID string, depth int, query string) e
 		}
 		return nil
 	}
-	logrus.Info("Starting collect data")
-	data, err := a.client.CollectData(ctx, userID, depth)
-	if err != nil {
-		return fmt.Errorf("collect data: %v", err)
+	run := models.CrawlRun{
+		ID:      newRunID(),
+		Seeds:   seeds,
+		Options: opts,
+		Outcome: models.RunRunning,
+	}
+	if err := a.storage.StartRun(ctx, run); err != nil {
+		return fmt.Errorf("start run: %v", err)
+	}
+	logrus.WithField("run_id", run.ID).Info("Starting collect data")
+
+	writer := a.storage.NewStreamWriter(ctx, run.ID)
+	stats, collectErr := a.client.CollectData(ctx, seeds, opts, writer)
+	logrus.WithFields(logrus.Fields{
+		"seeds":     stats.Seeds,
+		"expanded":  stats.Expanded,
+		"private":   stats.Private,
+		"deleted":   stats.Deleted,
+		"banned":    stats.Banned,
+		"failed":    stats.Failed,
+		"requests":  stats.Requests,
+		"exhausted": stats.Exhausted,
+	}).Info("Crawl finished")
+
+	// Дописываем всё, что успели собрать, даже если сбор прерван.
+	summary, saveErr := writer.Close()
+	logrus.WithFields(logrus.Fields{
+		"users":         summary.Users,
+		"groups":        summary.Groups,
+		"relationships": summary.Relationships,
+		"batches":       summary.Batches,
+	}).Info("Data saved to storage")
+
+	run.Stats = stats
+	run.Outcome = outcome(stats, collectErr, saveErr)
+	if err := errors.Join(collectErr, saveErr); err != nil {
+		run.Error = err.Error()
+	}
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishRunTimeout)
+	defer cancel()
+	if err := a.storage.FinishRun(finishCtx, run); err != nil {
+		logrus.Errorf("finish run %s: %v", run.ID, err)
 	}
-	logrus.Info("Save data to storage")
-	err = a.storage.SaveData(ctx, data)
-	if err != nil {
-		return fmt.Errorf("save data: %v", err)
+	logrus.WithFields(logrus.Fields{
+		"run_id":  run.ID,
+		"outcome": run.Outcome,
+	}).Info("Run recorded")
+
+	if collectErr != nil {
+		return fmt.Errorf("collect data: %v", collectErr)
+	}
+	if saveErr != nil {
+		return fmt.Errorf("save data: %v", saveErr)
 	}
 	return nil
 }
+
+// outcome определяет итог запуска обхода.
+func outcome(stats models.CrawlStats, collectErr, saveErr error) models.RunOutcome {
+	switch {
+	case errors.Is(collectErr, context.Canceled):
+		return models.RunCanceled
+	case collectErr != nil || saveErr != nil:
+		return models.RunFailed
+	case stats.Exhausted != "":
+		return models.RunExhausted
+	}
+	return models.RunCompleted
+}
+
+// newRunID возвращает идентификатор запуска обхода: время начала в UTC и случайный суффикс.
+func newRunID() string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,130 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+const fileName = "checkpoint.json"
+
+// ErrNotFound возвращается Load, если сохранённого состояния нет.
+var ErrNotFound = errors.New("checkpoint not found")
+
+// State — снимок обхода, по которому его можно продолжить. Собранные данные
+// в снимок не входят: снимок сохраняется только после того, как хранилище
+// подтвердило запись всего, что собрали раскрытые к этому моменту пользователи.
+type State struct {
+	Seeds    []models.NodeRef
+	Options  models.CrawlOptions
+	Hop      int
+	Frontier []int
+	Next     []int
+	Visited  []int
+	Reach    map[int][]models.SeedDistance
+	// GroupReach — от каких исходных узлов обход дошёл до групп.
+	GroupReach map[int][]models.SeedDistance
+	// Dirty — узлы, сведения о достижимости которых ещё не переданы в sink. nil в
+	// снимках старых версий: тогда при продолжении передаются все сведения.
+	Dirty     []models.NodeRef
+	Stats     models.CrawlStats
+	Completed bool
+	SavedAt   time.Time
+}
+
+// Checkpointer сохраняет состояние обхода в файл в каталоге состояния.
+// Снимок состояния предоставляет краулер через Track.
+type Checkpointer struct {
+	// Interval — период автоматического сохранения во время обхода. 0 отключает его.
+	Interval time.Duration
+
+	path string
+
+	mu       sync.Mutex
+	snapshot func() (*State, error)
+}
+
+// New создаёт Checkpointer, хранящий состояние в каталоге dir.
+func New(dir string, interval time.Duration) (*Checkpointer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	return &Checkpointer{Interval: interval, path: filepath.Join(dir, fileName)}, nil
+}
+
+// Track регистрирует функцию, возвращающую текущий снимок обхода. nil снимает регистрацию.
+func (c *Checkpointer) Track(snapshot func() (*State, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot = snapshot
+}
+
+// Flush сохраняет текущий снимок обхода, если обход идёт.
+func (c *Checkpointer) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot == nil {
+		return nil
+	}
+	state, err := c.snapshot()
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return c.save(state)
+}
+
+// Save сохраняет переданное состояние.
+func (c *Checkpointer) Save(state *State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save(state)
+}
+
+func (c *Checkpointer) save(state *State) error {
+	state.SavedAt = time.Now()
+	body, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы не оставить битый снимок.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("rename checkpoint: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"path":     c.path,
+		"hop":      state.Hop,
+		"frontier": len(state.Frontier),
+		"visited":  len(state.Visited),
+	}).Debug("Состояние обхода сохранено")
+	return nil
+}
+
+// Load читает сохранённое состояние.
+func (c *Checkpointer) Load() (*State, error) {
+	body, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(body, &state); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return &state, nil
+}
@@ -1,35 +1,348 @@
 package cli
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/config"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/queries"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strings"
+	"time"
 )
 
-func ParseArgs() (string, string, string, string) {
-	userID := flag.String("user_id", "self", "VK user ID (default is the current user).")
+// Команды, которые можно указать после флагов.
+const (
+	CommandMigrate = "migrate"
+	CommandDiff    = "diff"
+	CommandQueries = "queries"
+)
+
+// Режимы команды queries.
+const (
+	QueriesList     = "list"
+	QueriesDescribe = "describe"
+)
+
+// Форматы отчёта команды diff.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// Режимы команды migrate.
+const (
+	MigrateUp     = "up"
+	MigrateStatus = "status"
+	MigrateDryRun = "dry-run"
+)
+
+// Args содержит разобранные параметры командной строки.
+type Args struct {
+	// Command — команда после флагов (пусто — сбор данных или запрос), CommandArgs — её аргументы.
+	Command     string
+	CommandArgs []string
+	// DiffFrom и DiffTo — запуски обхода, которые сравнивает команда diff, Format — формат отчёта.
+	DiffFrom, DiffTo models.RunRef
+	Format           string
+
+	// UserIDs — пользователи (ID, короткие имена или ссылки), с которых начинается обход,
+	// GroupIDs — группы, с участников которых он начинается, SeedIDs — исходные узлы
+	// любого вида из seeds_file.
+	UserIDs  []string
+	GroupIDs []string
+	SeedIDs  []string
+	LogLevel string
+	LogFile  string
+	Query    string
+	// QueryParams — параметры запроса из -param и -as_of, проверенные по описанию запроса.
+	QueryParams map[string]string
+	// Queries — каталог предопределённых запросов: встроенные и из -queries_dir.
+	Queries *queries.Registry
+
+	VKRequestsPerSecond float64
+	VKMaxRetries        int
+	VKBatchWindow       time.Duration
+
+	Crawl models.CrawlOptions
+
+	StateDir           string
+	CheckpointInterval time.Duration
+
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+func ParseArgs() *Args {
+	userID := flag.String("user_id", "self", "Comma-separated VK user IDs, screen names (durov, id1) or profile URLs (default is the current user).")
+	groupID := flag.String("group_id", "", "Comma-separated VK group IDs, screen names (club1, apiclub) or URLs to crawl from their members.")
+	seedsFile := flag.String("seeds_file", "", "File with one user ID, screen name or URL per line to crawl from, in addition to -user_id and -group_id.")
 	logLevel := flag.String("log_level", "INFO", "Set the logging level (DEBUG, INFO, WARNING, ERROR, CRITICAL).")
 	logFile := flag.String("log_file", "", "Set the log file path. If not set, logs will be printed to console.")
 	query := flag.String("query", "", "Specify a predefined query to run after data collection.")
+	queriesDir := flag.String("queries_dir", "", "Directory with extra .cypher queries; a query with a built-in name replaces the built-in one.")
+	queryParams := paramsFlag{}
+	flag.Var(queryParams, "param", "Query parameter as key=value, e.g. -param limit=10 (repeatable).")
+	asOf := flag.String("as_of", "", "Moment for *_as_of queries: a date (2024-10-30) or RFC 3339 time (default is now); same as -param as_of=...")
+	format := flag.String("format", FormatTable, "Report format for the diff command: table or json.")
+	vkRPS := flag.Float64("vk_rps", config.DefaultVKRequestsPerSecond, "Maximum VK API requests per second (0 disables the limit).")
+	vkMaxRetries := flag.Int("vk_max_retries", config.DefaultVKMaxRetries, "Retries for transient VK API errors (codes 6, 9, 10 and HTTP 5xx).")
 
+	vkBatchWindow := flag.Duration("vk_batch_window", config.DefaultVKBatchWindow, "How long to collect concurrent VK API calls into one execute request (0 disables batching).")
+	workers := flag.Int("workers", config.DefaultCrawlWorkers, "Number of concurrent crawl workers.")
+	depth := flag.Int("depth", config.DefaultCrawlDepth, "Crawl depth: users closer to the seed than this number of hops are expanded.")
+	expand := flag.String("expand", config.DefaultCrawlExpand, "Comma-separated edge kinds to fetch and expand: friends, followers, subscriptions.")
+	maxUsers := flag.Int("max_users", 0, "Stop the crawl after expanding this many users (0 means no limit).")
+	maxFriends := flag.Int("max_friends_per_user", config.DefaultMaxFriendsPerUser, "Maximum friends fetched per user (0 means all).")
+	maxFollowers := flag.Int("max_followers_per_user", config.DefaultMaxFollowersPerUser, "Maximum followers fetched per user (0 means all).")
+	maxSubscriptions := flag.Int("max_subscriptions_per_user", config.DefaultMaxSubscriptionsPerUser, "Maximum subscriptions fetched per user (0 means all).")
+	maxMembers := flag.Int("max_members", config.DefaultMaxMembers, "Maximum members fetched for the -group_id group (0 means all).")
+	maxRequests := flag.Int("max_requests", 0, "Stop the crawl after this many VK API requests (0 means no limit).")
+	stateDir := flag.String("state_dir", "", "Directory for crawl checkpoints. If not set, checkpoints are disabled.")
+	resume := flag.Bool("resume", false, "Resume the crawl from the checkpoint in -state_dir.")
+	checkpointInterval := flag.Duration("checkpoint_interval", config.DefaultCheckpointInterval, "How often to checkpoint the crawl state.")
+	batchSize := flag.Int("batch_size", config.DefaultBatchSize, "Number of entities written to Neo4j in one batch.")
+	flushInterval := flag.Duration("flush_interval", config.DefaultFlushInterval, "How often to write an incomplete batch to Neo4j during the crawl.")
+
+	flag.Usage = usage
 	flag.Parse()
 
-	validQueries := map[string]bool{
-		"total_users":          true,
-		"total_groups":         true,
-		"top_users":            true,
-		"top_groups":           true,
-		"mutual_followers":     true,
-		"top_subscribers":      true,
-		"top_cities":           true,
-		"top_mutual_followers": true,
+	if *asOf != "" {
+		if _, ok := queryParams["as_of"]; ok {
+			logrus.Fatal("as_of is set both as a flag and as a param")
+		}
+		if _, err := models.ParseTime(*asOf); err != nil {
+			logrus.Fatalf("invalid as_of: %v", err)
+		}
+		queryParams["as_of"] = *asOf
+	}
+	if len(queryParams) > 0 && *query == "" {
+		logrus.Fatal("param and as_of require query")
+	}
+
+	registry, err := queries.Load(*queriesDir)
+	if err != nil {
+		logrus.Fatalf("load queries: %v", err)
+	}
+	if *query != "" {
+		q, ok := registry.Get(*query)
+		if !ok {
+			flag.Usage()
+			logrus.Fatalf("query %s not found, see the queries list command", *query)
+		}
+		if _, err := q.Bind(queryParams); err != nil {
+			logrus.Fatalf("query %s: %v", *query, err)
+		}
+	}
+
+	if *depth < 1 {
+		logrus.Fatalf("depth must be positive, got %d", *depth)
+	}
+	expandKinds, err := parseEdgeKinds(*expand)
+	if err != nil {
+		logrus.Fatalf("invalid expand: %v", err)
+	}
+	userIDs, groupIDs := splitList(*userID), splitList(*groupID)
+	// Текущий пользователь по умолчанию не добавляется к исходным узлам, заданным иначе.
+	if !isFlagSet("user_id") && (len(groupIDs) > 0 || *seedsFile != "") {
+		userIDs = nil
+	}
+	var seedIDs []string
+	if *seedsFile != "" {
+		seedIDs, err = readSeedsFile(*seedsFile)
+		if err != nil {
+			logrus.Fatalf("invalid seeds_file: %v", err)
+		}
+	}
+	if len(userIDs) == 0 && len(groupIDs) == 0 && len(seedIDs) == 0 {
+		logrus.Fatal("no seeds: user_id, group_id and seeds_file are empty")
+	}
+	if *resume && *stateDir == "" {
+		logrus.Fatal("resume requires state_dir")
 	}
 
-	if *query != "" && !validQueries[*query] {
-		logrus.Panicf("query %s not found", *query)
+	command, commandArgs := flag.Arg(0), flag.Args()
+	if len(commandArgs) > 0 {
+		commandArgs = commandArgs[1:]
+	}
+	switch command {
+	case "":
+	case CommandMigrate:
+		if len(commandArgs) != 1 || (commandArgs[0] != MigrateUp && commandArgs[0] != MigrateStatus && commandArgs[0] != MigrateDryRun) {
+			flag.Usage()
+			logrus.Fatalf("migrate expects one of: %s, %s, %s", MigrateUp, MigrateStatus, MigrateDryRun)
+		}
+	case CommandQueries:
+		switch {
+		case len(commandArgs) == 1 && commandArgs[0] == QueriesList:
+		case len(commandArgs) == 2 && commandArgs[0] == QueriesDescribe:
+			if _, ok := registry.Get(commandArgs[1]); !ok {
+				logrus.Fatalf("query %s not found", commandArgs[1])
+			}
+		default:
+			flag.Usage()
+			logrus.Fatalf("queries expects %s or %s <name>", QueriesList, QueriesDescribe)
+		}
+	case CommandDiff:
+		if len(commandArgs) != 2 {
+			flag.Usage()
+			logrus.Fatal("diff expects two crawl run IDs or timestamps")
+		}
+		if *format != FormatTable && *format != FormatJSON {
+			logrus.Fatalf("unknown format %s, expected %s or %s", *format, FormatTable, FormatJSON)
+		}
+	default:
 		flag.Usage()
-		os.Exit(1)
+		logrus.Fatalf("unknown command %s", command)
+	}
+	var diffFrom, diffTo models.RunRef
+	if command == CommandDiff {
+		diffFrom, diffTo = parseRunRef(commandArgs[0]), parseRunRef(commandArgs[1])
 	}
 
-	return *userID, *logLevel, *logFile, *query
+	return &Args{
+		Command:             command,
+		CommandArgs:         commandArgs,
+		DiffFrom:            diffFrom,
+		DiffTo:              diffTo,
+		Format:              *format,
+		UserIDs:             userIDs,
+		GroupIDs:            groupIDs,
+		SeedIDs:             seedIDs,
+		LogLevel:            *logLevel,
+		LogFile:             *logFile,
+		Query:               *query,
+		QueryParams:         queryParams,
+		Queries:             registry,
+		VKRequestsPerSecond: *vkRPS,
+		VKMaxRetries:        *vkMaxRetries,
+		VKBatchWindow:       *vkBatchWindow,
+		Crawl: models.CrawlOptions{
+			Depth:                   *depth,
+			Expand:                  expandKinds,
+			MaxUsers:                *maxUsers,
+			MaxFriendsPerUser:       *maxFriends,
+			MaxFollowersPerUser:     *maxFollowers,
+			MaxSubscriptionsPerUser: *maxSubscriptions,
+			MaxMembers:              *maxMembers,
+			MaxRequests:             *maxRequests,
+			Workers:                 *workers,
+			Resume:                  *resume,
+		},
+		StateDir:           *stateDir,
+		CheckpointInterval: *checkpointInterval,
+		BatchSize:          *batchSize,
+		FlushInterval:      *flushInterval,
+	}
+}
+
+// isFlagSet сообщает, что флаг явно указан в командной строке.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// splitList разбирает список значений через запятую, пропуская пустые.
+func splitList(value string) []string {
+	var items []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// readSeedsFile читает исходные узлы из файла: по одному на строку или через запятую.
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+func readSeedsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, splitList(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return seeds, nil
+}
+
+// paramsFlag собирает повторяющийся флаг -param key=value.
+type paramsFlag map[string]string
+
+func (p paramsFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for key, value := range p {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p paramsFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	if _, exists := p[key]; exists {
+		return fmt.Errorf("param %s is set twice", key)
+	}
+	p[key] = val
+	return nil
+}
+
+// parseRunRef разбирает ссылку на запуск обхода: момент времени или идентификатор запуска.
+func parseRunRef(value string) models.RunRef {
+	if t, err := models.ParseTime(value); err == nil {
+		return models.RunRef{At: t}
+	}
+	return models.RunRef{ID: value}
+}
+
+// parseEdgeKinds разбирает список видов связей через запятую; пустой список — ошибка.
+func parseEdgeKinds(value string) ([]models.EdgeKind, error) {
+	var kinds []models.EdgeKind
+	for _, part := range strings.Split(value, ",") {
+		kind := models.EdgeKind(strings.TrimSpace(part))
+		switch kind {
+		case "":
+			continue
+		case models.EdgeFriends, models.EdgeFollowers, models.EdgeSubscriptions:
+			kinds = append(kinds, kind)
+		default:
+			return nil, fmt.Errorf("unknown edge kind %q", kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no edge kinds, expected friends, followers or subscriptions")
+	}
+	return kinds, nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Commands:")
+	fmt.Fprintln(out, "  migrate up|status|dry-run\tapply, show or preview Neo4j schema migrations")
+	fmt.Fprintln(out, "  queries list|describe <name>\tlist predefined queries or show one with its params and columns")
+	fmt.Fprintln(out, "  diff <run|time> <run|time>\tshow nodes and edges added, removed and changed between two crawl runs")
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
@@ -0,0 +1,812 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/checkpoint"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// crawler обходит граф пользователей в ширину пулом воркеров и передаёт найденные
+// сущности в sink. Состояние обхода и счётчики бюджета защищены mu.
+type crawler struct {
+	vk            *VKClient
+	sink          models.Sink
+	seeds         []models.NodeRef
+	opts          models.CrawlOptions
+	startRequests int64
+
+	mu      sync.Mutex
+	hop     int
+	pending map[int]bool // пользователи текущего уровня, ещё не раскрытые до конца
+	next    []int
+	visited map[int]bool
+	reach   map[models.NodeRef][]models.SeedDistance // от каких исходных узлов обход дошёл до узла
+	dirty   map[models.NodeRef]bool                  // узлы, чьи reach ещё не переданы в sink
+	groups  map[int]bool                             // группы, уже встречавшиеся в обходе
+	stats   models.CrawlStats
+}
+
+// expansion — результат раскрытия одного пользователя.
+type expansion struct {
+	user          *models.User
+	groups        []models.Group
+	relationships []models.Relationship
+	neighbours    []int
+	// groupNeighbours — группы, до которых обход дошёл через пользователя (подписки).
+	groupNeighbours []int
+	// edgeSets — полностью полученные наборы связей для сверки в режиме обновления.
+	edgeSets []models.EdgeSet
+}
+
+func newCrawler(vk *VKClient, sink models.Sink, seeds []models.NodeRef, opts models.CrawlOptions) *crawler {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	c := &crawler{
+		vk:            vk,
+		sink:          sink,
+		seeds:         seeds,
+		opts:          opts,
+		startRequests: vk.RequestCount(),
+		pending:       make(map[int]bool),
+		visited:       make(map[int]bool),
+		reach:         make(map[models.NodeRef][]models.SeedDistance),
+		dirty:         make(map[models.NodeRef]bool),
+		groups:        make(map[int]bool),
+	}
+	// Группа — исходный узел на расстоянии 0, её участники — следующий уровень обхода,
+	// их добавляет seedGroup.
+	for _, seed := range seeds {
+		c.reach[seed] = append(c.reach[seed], models.SeedDistance{Seed: seed})
+		c.dirty[seed] = true
+		if seed.Kind == models.NodeUser {
+			c.pending[seed.ID] = true
+			c.visited[seed.ID] = true
+		}
+	}
+	return c
+}
+
+// restore продолжает обход с сохранённого состояния.
+func (c *crawler) restore(state *checkpoint.State) {
+	c.hop = state.Hop
+	c.pending = make(map[int]bool, len(state.Frontier))
+	for _, id := range state.Frontier {
+		c.pending[id] = true
+	}
+	c.next = state.Next
+	c.visited = make(map[int]bool, len(state.Visited))
+	for _, id := range state.Visited {
+		c.visited[id] = true
+	}
+	c.reach = make(map[models.NodeRef][]models.SeedDistance, len(state.Reach)+len(state.GroupReach))
+	for id, seeds := range state.Reach {
+		c.reach[models.UserRef(id)] = seeds
+	}
+	for id, seeds := range state.GroupReach {
+		c.reach[models.GroupRef(id)] = seeds
+	}
+	// Сведения о фронтире и не переданные в sink сведения о посещённых узлах
+	// могли не дойти до хранилища до остановки: передаём их повторно.
+	c.dirty = make(map[models.NodeRef]bool)
+	dirty := state.Dirty
+	if dirty == nil {
+		dirty = slices.Collect(maps.Keys(c.reach))
+	}
+	for _, node := range dirty {
+		c.dirty[node] = true
+	}
+	for _, id := range slices.Concat(state.Frontier, state.Next) {
+		c.dirty[models.UserRef(id)] = true
+	}
+	// Бюджет запросов и его исчерпание отсчитываются заново в каждом запуске.
+	c.stats = state.Stats
+	c.stats.Requests = 0
+	c.stats.Exhausted = ""
+}
+
+// checkResumeOptions сравнивает параметры сохранённого обхода с текущими. Параметры,
+// задающие форму обхода, менять при продолжении нельзя: иначе часть графа была бы собрана
+// с одними параметрами, а часть — с другими. Бюджет менять можно, например чтобы продолжить
+// исчерпавший его обход, но об этом выводится предупреждение.
+func checkResumeOptions(saved, current models.CrawlOptions) error {
+	var changed []string
+	for name, differs := range map[string]bool{
+		"depth":                      saved.Depth != current.Depth,
+		"expand":                     !slices.Equal(saved.Expand, current.Expand),
+		"max_friends_per_user":       saved.MaxFriendsPerUser != current.MaxFriendsPerUser,
+		"max_followers_per_user":     saved.MaxFollowersPerUser != current.MaxFollowersPerUser,
+		"max_subscriptions_per_user": saved.MaxSubscriptionsPerUser != current.MaxSubscriptionsPerUser,
+		"max_members":                saved.MaxMembers != current.MaxMembers,
+	} {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		return fmt.Errorf("checkpoint was saved with different %s, resume with the same flags or start over",
+			strings.Join(changed, ", "))
+	}
+
+	if saved.MaxUsers != current.MaxUsers || saved.MaxRequests != current.MaxRequests {
+		logrus.WithFields(logrus.Fields{
+			"saved_max_users":    saved.MaxUsers,
+			"max_users":          current.MaxUsers,
+			"saved_max_requests": saved.MaxRequests,
+			"max_requests":       current.MaxRequests,
+		}).Warning("Бюджет обхода отличается от сохранённого, продолжение идёт с новым бюджетом")
+	}
+	return nil
+}
+
+// snapshot возвращает согласованный снимок обхода. Пользователи, которых воркеры
+// раскрывают в момент снимка, остаются во фронтире и будут раскрыты повторно.
+// Снимок возвращается только после того, как sink записал всё переданное
+// уже раскрытыми пользователями: иначе при продолжении их данные были бы потеряны.
+func (c *crawler) snapshot() (*checkpoint.State, error) {
+	state := c.state()
+	if err := c.sink.Sync(context.Background()); err != nil {
+		return nil, fmt.Errorf("sync sink: %w", err)
+	}
+	return state, nil
+}
+
+// state копирует текущее состояние обхода. Всё, что пользователи вне c.pending
+// передали в sink, к этому моменту уже принято sink: commit идёт после emit.
+func (c *crawler) state() *checkpoint.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reach := make(map[int][]models.SeedDistance, len(c.reach))
+	groupReach := make(map[int][]models.SeedDistance)
+	for node, seeds := range c.reach {
+		if node.Kind == models.NodeGroup {
+			groupReach[node.ID] = slices.Clone(seeds)
+		} else {
+			reach[node.ID] = slices.Clone(seeds)
+		}
+	}
+	return &checkpoint.State{
+		Seeds:      c.seeds,
+		Options:    c.opts,
+		Hop:        c.hop,
+		Frontier:   slices.Collect(maps.Keys(c.pending)),
+		Next:       slices.Clone(c.next),
+		Visited:    slices.Collect(maps.Keys(c.visited)),
+		Reach:      reach,
+		GroupReach: groupReach,
+		Dirty:      slices.Collect(maps.Keys(c.dirty)),
+		Stats:      c.stats,
+		Completed:  c.hop >= c.opts.Depth || len(c.pending) == 0 && len(c.next) == 0,
+	}
+}
+
+// CollectData собирает данные о пользователях, их фолловерах и подписках до глубины opts.Depth
+// и передаёт их в sink по мере сбора: раскрываются пользователи, находящиеся от ближайшего
+// исходного узла на расстоянии меньше opts.Depth. Участники исходной группы находятся
+// от неё на расстоянии 1, как соседи исходного пользователя.
+// Все исходные узлы обходятся вместе с общим множеством посещённых; для каждого узла
+// в sink передаётся, от каких исходных узлов и на каком расстоянии до него дошёл обход.
+// При исчерпании бюджета обход останавливается без ошибки.
+// Если задан vk.Checkpointer, состояние обхода периодически сохраняется, а при opts.Resume
+// обход продолжается с последнего сохранённого состояния.
+func (vk *VKClient) CollectData(ctx context.Context, seeds []models.NodeRef, opts models.CrawlOptions, sink models.Sink) (models.CrawlStats, error) {
+	logrus.Infof("Начало сбора данных для %v с глубиной: %d", seeds, opts.Depth)
+	if len(seeds) == 0 {
+		return models.CrawlStats{}, fmt.Errorf("no seeds")
+	}
+	for _, seed := range seeds {
+		if seed.Kind != models.NodeUser && seed.Kind != models.NodeGroup {
+			return models.CrawlStats{}, fmt.Errorf("unsupported seed %s", seed)
+		}
+	}
+
+	c := newCrawler(vk, sink, seeds, opts)
+	resumed := false
+	if cp := vk.Checkpointer; cp != nil && opts.Resume {
+		state, err := cp.Load()
+		if err != nil {
+			return models.CrawlStats{}, fmt.Errorf("load checkpoint: %w", err)
+		}
+		if !slices.Equal(state.Seeds, seeds) {
+			return models.CrawlStats{}, fmt.Errorf("checkpoint belongs to %v, not %v", state.Seeds, seeds)
+		}
+		if err := checkResumeOptions(state.Options, opts); err != nil {
+			return models.CrawlStats{}, err
+		}
+		c.restore(state)
+		resumed = true
+		logrus.WithFields(logrus.Fields{
+			"hop":      state.Hop,
+			"frontier": len(state.Frontier),
+			"visited":  len(state.Visited),
+			"saved_at": state.SavedAt,
+		}).Info("Обход продолжается с сохранённого состояния")
+	}
+
+	if !resumed {
+		for _, seed := range seeds {
+			if seed.Kind != models.NodeGroup {
+				continue
+			}
+			if err := c.seedGroup(ctx, seed.ID); err != nil {
+				return c.summary(), err
+			}
+		}
+	}
+	if err := c.flushReach(ctx); err != nil {
+		return c.summary(), err
+	}
+
+	if cp := vk.Checkpointer; cp != nil {
+		cp.Track(c.snapshot)
+		defer cp.Track(nil)
+
+		autosaveCtx, stopAutosave := context.WithCancel(ctx)
+		defer stopAutosave()
+		go c.autosave(autosaveCtx, cp)
+	}
+
+	if err := c.run(ctx); err != nil {
+		return c.summary(), err
+	}
+
+	if cp := vk.Checkpointer; cp != nil {
+		if err := cp.Flush(); err != nil {
+			logrus.Warningf("Не удалось сохранить состояние обхода: %v", err)
+		}
+	}
+
+	stats := c.summary()
+	if stats.Exhausted != "" {
+		logrus.WithFields(logrus.Fields{
+			"budget":   stats.Exhausted,
+			"users":    stats.Expanded,
+			"requests": stats.Requests,
+		}).Warning("Бюджет обхода исчерпан, сбор данных остановлен досрочно")
+		return stats, nil
+	}
+	logrus.Infof("Сбор данных для %v завершен успешно", seeds)
+	return stats, nil
+}
+
+// summary возвращает итог обхода на текущий момент.
+func (c *crawler) summary() models.CrawlStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Seeds = len(c.seeds)
+	stats.Requests = c.vk.RequestCount() - c.startRequests
+	return stats
+}
+
+// seedGroup передаёт в sink исходную группу и связи MEMBER_OF её участников,
+// а участников добавляет в следующий уровень обхода: они на шаг дальше группы.
+func (c *crawler) seedGroup(ctx context.Context, groupID int) error {
+	seed := models.GroupRef(groupID)
+	groups, err := c.enrichGroups(ctx, []models.Group{{ID: groupID}})
+	if err != nil {
+		return err
+	}
+
+	members, err := c.vk.GetGroupMembers(ctx, groupID, c.opts.MaxMembers)
+	if err != nil {
+		return fmt.Errorf("get group members (%d): %w", groupID, err)
+	}
+
+	exp := &expansion{groups: groups}
+	for _, member := range members {
+		exp.relationships = append(exp.relationships, models.Relationship{
+			From: models.UserRef(member.ID),
+			To:   models.GroupRef(groupID),
+			Type: models.RelMemberOf,
+		})
+		exp.neighbours = append(exp.neighbours, member.ID)
+	}
+	if err := c.emit(ctx, exp); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	for _, id := range exp.neighbours {
+		c.reached(models.UserRef(id), c.reach[seed])
+		if !c.visited[id] {
+			c.visited[id] = true
+			c.next = append(c.next, id)
+		}
+	}
+	c.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"group_id": groupID,
+		"members":  len(members),
+	}).Info("Участники группы получены")
+	return nil
+}
+
+// autosave периодически сохраняет состояние обхода до отмены ctx.
+func (c *crawler) autosave(ctx context.Context, cp *checkpoint.Checkpointer) {
+	if cp.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cp.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cp.Flush(); err != nil {
+				logrus.Warningf("Не удалось сохранить состояние обхода: %v", err)
+			}
+		}
+	}
+}
+
+// run обходит граф по уровням: уровень hop раскрывается целиком до перехода к следующему,
+// поэтому каждый пользователь раскрывается на своём кратчайшем расстоянии от исходного.
+func (c *crawler) run(ctx context.Context) error {
+	// Уровень может быть пуст, если исходные узлы — только группы: их участники уже в c.next.
+	for c.hop < c.opts.Depth && (len(c.pending) > 0 || len(c.next) > 0) {
+		frontier := slices.Collect(maps.Keys(c.pending))
+		if err := c.expandLevel(ctx, frontier); err != nil {
+			return err
+		}
+		if err := c.flushReach(ctx); err != nil {
+			return err
+		}
+		if c.stats.Exhausted != "" {
+			return nil
+		}
+
+		c.mu.Lock()
+		logrus.WithFields(logrus.Fields{
+			"hop":      c.hop,
+			"expanded": len(frontier),
+			"next":     len(c.next),
+		}).Info("Уровень обхода завершён")
+		c.hop++
+		c.pending = make(map[int]bool, len(c.next))
+		for _, id := range c.next {
+			c.pending[id] = true
+		}
+		c.next = nil
+		c.mu.Unlock()
+
+		if cp := c.vk.Checkpointer; cp != nil {
+			if err := cp.Flush(); err != nil {
+				logrus.Warningf("Не удалось сохранить состояние обхода: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandLevel раскрывает пользователей уровня; впервые найденные соседи попадают в c.next.
+func (c *crawler) expandLevel(ctx context.Context, frontier []int) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range jobs {
+				if !c.reserve() {
+					continue
+				}
+				exp, err := c.expandUser(ctx, userID)
+				if isFatal(err) {
+					cancel(err)
+					continue
+				}
+				if err != nil {
+					logrus.Errorf("Ошибка сбора данных для пользователя ID: %d: %v", userID, err)
+					// Продолжаем сбор данных для остальных пользователей
+				}
+				// Пользователь остаётся во фронтире, пока его данные не приняты sink.
+				if emitErr := c.emit(ctx, exp); emitErr != nil {
+					cancel(emitErr)
+					continue
+				}
+				c.commit(userID, exp, err != nil)
+			}
+		}()
+	}
+
+feed:
+	for _, userID := range frontier {
+		select {
+		case jobs <- userID:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+// emit передаёт результат раскрытия в sink.
+func (c *crawler) emit(ctx context.Context, exp *expansion) error {
+	if exp == nil {
+		return nil
+	}
+	if exp.user != nil {
+		if err := c.sink.AddUser(ctx, *exp.user); err != nil {
+			return fmt.Errorf("emit user %d: %w", exp.user.ID, err)
+		}
+	}
+	for _, group := range exp.groups {
+		if err := c.sink.AddGroup(ctx, group); err != nil {
+			return fmt.Errorf("emit group %d: %w", group.ID, err)
+		}
+	}
+	for _, set := range exp.edgeSets {
+		if err := c.sink.AddEdgeSet(ctx, set); err != nil {
+			return fmt.Errorf("emit edge set %s %s: %w", set.Owner, set.Type, err)
+		}
+	}
+	for _, rel := range exp.relationships {
+		if err := c.sink.AddRelationship(ctx, rel); err != nil {
+			return fmt.Errorf("emit relationship %s %s -> %s: %w", rel.Type, rel.From, rel.To, err)
+		}
+	}
+	return nil
+}
+
+// commit убирает раскрытого пользователя из фронтира, учитывает его в итоге обхода
+// и добавляет новых соседей в следующий уровень.
+func (c *crawler) commit(userID int, exp *expansion, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, userID)
+	if failed {
+		c.stats.Failed++
+	}
+	if exp == nil {
+		return
+	}
+	if exp.user != nil {
+		switch exp.user.Status {
+		case models.StatusPrivate:
+			c.stats.Private++
+		case models.StatusDeleted:
+			c.stats.Deleted++
+		case models.StatusBanned:
+			c.stats.Banned++
+		}
+	}
+	via := c.reach[models.UserRef(userID)]
+	for _, id := range exp.groupNeighbours {
+		c.reached(models.GroupRef(id), via)
+	}
+	for _, id := range exp.neighbours {
+		c.reached(models.UserRef(id), via)
+		if !c.visited[id] {
+			c.visited[id] = true
+			c.next = append(c.next, id)
+		}
+	}
+}
+
+// reached отмечает, что обход дошёл до узла node на шаг дальше, чем до узла
+// с исходными узлами via. Вызывается под c.mu.
+func (c *crawler) reached(node models.NodeRef, via []models.SeedDistance) {
+	current := c.reach[node]
+	changed := false
+	for _, v := range via {
+		i := slices.IndexFunc(current, func(r models.SeedDistance) bool { return r.Seed == v.Seed })
+		switch {
+		case i < 0:
+			current = append(current, models.SeedDistance{Seed: v.Seed, Distance: v.Distance + 1})
+		case current[i].Distance > v.Distance+1:
+			current[i].Distance = v.Distance + 1
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		c.reach[node] = current
+		c.dirty[node] = true
+	}
+}
+
+// flushReach передаёт в sink изменившиеся сведения об исходных узлах. Вызывается между
+// уровнями обхода, чтобы в sink не попали устаревшие сведения от параллельных воркеров.
+func (c *crawler) flushReach(ctx context.Context) error {
+	c.mu.Lock()
+	updates := make(map[models.NodeRef][]models.SeedDistance, len(c.dirty))
+	for node := range c.dirty {
+		seeds := slices.Clone(c.reach[node])
+		// Порядок не зависит от того, какой воркер дошёл до пользователя первым.
+		slices.SortFunc(seeds, func(a, b models.SeedDistance) int {
+			if a.Distance != b.Distance {
+				return a.Distance - b.Distance
+			}
+			return strings.Compare(a.Seed.String(), b.Seed.String())
+		})
+		updates[node] = seeds
+	}
+	c.dirty = make(map[models.NodeRef]bool)
+	c.mu.Unlock()
+
+	for node, seeds := range updates {
+		if err := c.sink.AddReach(ctx, node, seeds); err != nil {
+			return fmt.Errorf("emit reach %s: %w", node, err)
+		}
+	}
+	return nil
+}
+
+// reserve проверяет бюджет обхода и резервирует раскрытие ещё одного пользователя.
+// Запросы, уже выполняемые другими воркерами, могут немного превысить MaxRequests.
+func (c *crawler) reserve() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stats.Exhausted != "" {
+		return false
+	}
+	if c.opts.MaxUsers > 0 && c.stats.Expanded >= c.opts.MaxUsers {
+		c.stats.Exhausted = "max_users"
+		return false
+	}
+	if c.opts.MaxRequests > 0 && c.vk.RequestCount()-c.startRequests >= int64(c.opts.MaxRequests) {
+		c.stats.Exhausted = "max_requests"
+		return false
+	}
+	c.stats.Expanded++
+	return true
+}
+
+// expandUser получает данные пользователя и выбранные в opts.Expand связи: друзей,
+// фолловеров и подписки. Если данные пользователя получены, результат возвращается
+// и вместе с ошибкой.
+func (c *crawler) expandUser(ctx context.Context, userID int) (*expansion, error) {
+	// Все запросы по пользователю выполняются одновременно, чтобы попасть в один запрос execute.
+	var (
+		wg                                                sync.WaitGroup
+		userInfo                                          models.User
+		friends, followers                                []models.User
+		subscriptions                                     []models.Subscription
+		userInfoErr, friendsErr, followersErr, subscrsErr error
+	)
+	fetch := func(enabled bool, f func()) {
+		if !enabled {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+	fetch(true, func() {
+		userInfo, userInfoErr = c.vk.GetUserFullData(ctx, userID)
+	})
+	fetch(c.opts.Expands(models.EdgeFriends), func() {
+		friends, friendsErr = c.vk.GetFriends(ctx, userID, c.opts.MaxFriendsPerUser)
+	})
+	fetch(c.opts.Expands(models.EdgeFollowers), func() {
+		followers, followersErr = c.vk.GetFollowers(ctx, userID, c.opts.MaxFollowersPerUser)
+	})
+	fetch(c.opts.Expands(models.EdgeSubscriptions), func() {
+		subscriptions, subscrsErr = c.vk.GetSubscriptions(ctx, userID, c.opts.MaxSubscriptionsPerUser)
+	})
+	wg.Wait()
+
+	// Информация о пользователе
+	if status, ok := unavailableStatus(userInfoErr); ok {
+		logrus.Debugf("Профиль пользователя ID: %d недоступен: %v", userID, userInfoErr)
+		return &expansion{user: &models.User{ID: userID, Status: status}}, nil
+	}
+	if userInfoErr != nil {
+		return nil, fmt.Errorf("get user info (%d): %w", userID, userInfoErr)
+	}
+
+	exp := &expansion{user: &userInfo}
+
+	// Закрытые, удалённые и заблокированные профили сохраняются без связей и не раскрываются.
+	if userInfo.Status != models.StatusActive {
+		logrus.Debugf("Пользователь ID: %d не раскрывается: %s", userID, userInfo.Status)
+		return exp, nil
+	}
+
+	// Связи каждого вида обрабатываются независимо: недоступные пропускаются,
+	// остальные ошибки возвращаются вместе с тем, что удалось получить.
+	var errs []error
+	for _, edges := range []struct {
+		kind models.EdgeKind
+		err  error
+	}{
+		{models.EdgeFriends, friendsErr},
+		{models.EdgeFollowers, followersErr},
+		{models.EdgeSubscriptions, subscrsErr},
+	} {
+		kind, err := edges.kind, edges.err
+		switch {
+		case err == nil:
+		case isSkippable(err):
+			logrus.Debugf("Связи %s пользователя ID: %d недоступны: %v", kind, userID, err)
+		default:
+			errs = append(errs, fmt.Errorf("get user %s (%d): %w", kind, userID, err))
+		}
+	}
+
+	// Обработка друзей
+	for _, friend := range friends {
+		// Дружба взаимна и хранится одной связью от меньшего ID к большему.
+		exp.relationships = append(exp.relationships, models.Relationship{
+			From: models.UserRef(min(userID, friend.ID)),
+			To:   models.UserRef(max(userID, friend.ID)),
+			Type: models.RelFriends,
+		})
+		exp.neighbours = append(exp.neighbours, friend.ID)
+	}
+
+	// Обработка фолловеров
+	for _, follower := range followers {
+		exp.relationships = append(exp.relationships, models.Relationship{
+			From: models.UserRef(follower.ID),
+			To:   models.UserRef(userID),
+			Type: models.RelFollows,
+		})
+		exp.neighbours = append(exp.neighbours, follower.ID)
+	}
+
+	// Обработка подписок
+	for _, subscription := range subscriptions {
+		if strings.ToLower(subscription.Type) == "page" || strings.ToLower(subscription.Type) == "group" {
+			exp.groups = append(exp.groups, models.Group{
+				ID:         subscription.ID,
+				Name:       subscription.Name,
+				ScreenName: subscription.ScreenName,
+			})
+
+			exp.relationships = append(exp.relationships, models.Relationship{
+				From: models.UserRef(userID),
+				To:   models.GroupRef(subscription.ID),
+				Type: models.RelSubscribes,
+			})
+			exp.groupNeighbours = append(exp.groupNeighbours, subscription.ID)
+		} else if strings.ToLower(subscription.Type) == "profile" {
+			// Подписка на пользователя — та же связь, что фолловер с другой стороны.
+			exp.relationships = append(exp.relationships, models.Relationship{
+				From: models.UserRef(userID),
+				To:   models.UserRef(subscription.ID),
+				Type: models.RelFollows,
+			})
+			exp.neighbours = append(exp.neighbours, subscription.ID)
+		}
+	}
+
+	exp.edgeSets = c.edgeSets(userID, friends, followers, subscriptions, friendsErr, followersErr, subscrsErr)
+
+	groups, err := c.enrichGroups(ctx, exp.groups)
+	if err != nil {
+		return exp, err
+	}
+	exp.groups = groups
+
+	return exp, errors.Join(errs...)
+}
+
+// edgeSets собирает наборы связей пользователя для сверки с хранилищем. В сверку попадают
+// только виды связей, полученные без ошибок и целиком: если список обрезан лимитом,
+// отсутствие в нём связи не означает, что она исчезла.
+func (c *crawler) edgeSets(userID int, friends, followers []models.User, subscriptions []models.Subscription,
+	friendsErr, followersErr, subscrsErr error) []models.EdgeSet {
+	complete := func(kind models.EdgeKind, err error, fetched, limit int) bool {
+		return c.opts.Expands(kind) && err == nil && (limit == 0 || fetched < limit)
+	}
+	owner := models.UserRef(userID)
+	var sets []models.EdgeSet
+
+	if complete(models.EdgeFriends, friendsErr, len(friends), c.opts.MaxFriendsPerUser) {
+		set := models.EdgeSet{Owner: owner, Type: models.RelFriends, Direction: models.DirectionBoth, Other: models.NodeUser}
+		for _, friend := range friends {
+			set.IDs = append(set.IDs, friend.ID)
+		}
+		sets = append(sets, set)
+	}
+	if complete(models.EdgeFollowers, followersErr, len(followers), c.opts.MaxFollowersPerUser) {
+		set := models.EdgeSet{Owner: owner, Type: models.RelFollows, Direction: models.DirectionIn, Other: models.NodeUser}
+		for _, follower := range followers {
+			set.IDs = append(set.IDs, follower.ID)
+		}
+		sets = append(sets, set)
+	}
+	if complete(models.EdgeSubscriptions, subscrsErr, len(subscriptions), c.opts.MaxSubscriptionsPerUser) {
+		groups := models.EdgeSet{Owner: owner, Type: models.RelSubscribes, Direction: models.DirectionOut, Other: models.NodeGroup}
+		profiles := models.EdgeSet{Owner: owner, Type: models.RelFollows, Direction: models.DirectionOut, Other: models.NodeUser}
+		for _, subscription := range subscriptions {
+			switch strings.ToLower(subscription.Type) {
+			case "page", "group":
+				groups.IDs = append(groups.IDs, subscription.ID)
+			case "profile":
+				profiles.IDs = append(profiles.IDs, subscription.ID)
+			}
+		}
+		sets = append(sets, groups, profiles)
+	}
+	return sets
+}
+
+// enrichGroups оставляет группы, ещё не встречавшиеся в обходе, и дополняет их данными
+// groups.getById. Если получить данные не удалось, группы сохраняются как есть.
+func (c *crawler) enrichGroups(ctx context.Context, groups []models.Group) ([]models.Group, error) {
+	c.mu.Lock()
+	var fresh []models.Group
+	for _, group := range groups {
+		if !c.groups[group.ID] {
+			c.groups[group.ID] = true
+			fresh = append(fresh, group)
+		}
+	}
+	c.mu.Unlock()
+	if len(fresh) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int, len(fresh))
+	for i, group := range fresh {
+		ids[i] = group.ID
+	}
+	enriched, err := c.vk.GetGroupsByID(ctx, ids)
+	if isFatal(err) {
+		return nil, err
+	}
+	if err != nil {
+		logrus.Warningf("Не удалось получить данные групп, сохраняются краткие данные: %v", err)
+		return fresh, nil
+	}
+
+	byID := make(map[int]models.Group, len(enriched))
+	for _, group := range enriched {
+		byID[group.ID] = group
+	}
+	for i, group := range fresh {
+		if full, ok := byID[group.ID]; ok {
+			fresh[i] = full
+		}
+	}
+	return fresh, nil
+}
+
+// unavailableStatus возвращает статус профиля, если err означает, что профиль закрыт или удалён.
+func unavailableStatus(err error) (models.UserStatus, bool) {
+	switch {
+	case IsDeleted(err):
+		return models.StatusDeleted, true
+	case IsPrivateProfile(err):
+		return models.StatusPrivate, true
+	}
+	return "", false
+}
+
+// isSkippable сообщает, что ветку обхода можно пропустить: профиль закрыт или удалён.
+func isSkippable(err error) bool {
+	return IsPrivateProfile(err) || IsDeleted(err)
+}
+
+// isFatal сообщает, что продолжать обход бессмысленно: токен недействителен или сбор отменён.
+func isFatal(err error) bool {
+	return IsAuthFailed(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Коды ошибок VK API, на которые реагирует клиент и краулер.
+const (
+	ErrCodeAuthFailed      = 5
+	ErrCodeTooManyRequests = 6
+	ErrCodeFloodControl    = 9
+	ErrCodeInternal        = 10
+	ErrCodeUserDeleted     = 18
+	ErrCodePrivateProfile  = 30
+)
+
+// APIError — ошибка, которую вернул VK API в поле error ответа.
+type APIError struct {
+	Method        string
+	Code          int
+	Message       string
+	RequestParams map[string]string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("vk api error %d (%s): %s", e.Code, e.Method, e.Message)
+}
+
+// apiErrorPayload — формат поля error в ответе VK API.
+type apiErrorPayload struct {
+	ErrorCode     int    `json:"error_code"`
+	ErrorMsg      string `json:"error_msg"`
+	RequestParams []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"request_params"`
+}
+
+func (p *apiErrorPayload) toAPIError(method string) *APIError {
+	params := make(map[string]string, len(p.RequestParams))
+	for _, param := range p.RequestParams {
+		if param.Key == "access_token" {
+			continue
+		}
+		params[param.Key] = param.Value
+	}
+	return &APIError{
+		Method:        method,
+		Code:          p.ErrorCode,
+		Message:       p.ErrorMsg,
+		RequestParams: params,
+	}
+}
+
+// httpStatusError — ответ VK API с неожиданным HTTP-статусом.
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// APIErrorCode возвращает код ошибки VK API из цепочки err или 0, если это не ошибка VK API.
+func APIErrorCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
+// IsPrivateProfile сообщает, что профиль пользователя закрыт (код 30).
+func IsPrivateProfile(err error) bool {
+	return APIErrorCode(err) == ErrCodePrivateProfile
+}
+
+// IsDeleted сообщает, что страница пользователя удалена или заблокирована (код 18).
+func IsDeleted(err error) bool {
+	return APIErrorCode(err) == ErrCodeUserDeleted
+}
+
+// IsRateLimited сообщает о превышении частоты запросов (код 6).
+func IsRateLimited(err error) bool {
+	return APIErrorCode(err) == ErrCodeTooManyRequests
+}
+
+// IsAuthFailed сообщает о недействительном токене доступа (код 5).
+func IsAuthFailed(err error) bool {
+	return APIErrorCode(err) == ErrCodeAuthFailed
+}
+
+// IsTransient сообщает, что запрос завершился временной ошибкой и его можно повторить.
+func IsTransient(err error) bool {
+	switch APIErrorCode(err) {
+	case ErrCodeTooManyRequests, ErrCodeFloodControl, ErrCodeInternal:
+		return true
+	}
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,243 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxExecuteCalls — максимальное число вызовов API в одном запросе execute.
+const maxExecuteCalls = 25
+
+type batchResult struct {
+	raw json.RawMessage
+	err error
+}
+
+type batchCall struct {
+	ctx    context.Context
+	method string
+	params url.Values
+	result chan batchResult
+	// err — последняя временная ошибка вызова, пока он ждёт повтора.
+	err error
+}
+
+// executeResult — ответ метода execute: результаты вызовов по порядку и ошибки
+// неудавшихся вызовов (каждому такому вызову в Items соответствует false).
+type executeResult struct {
+	Items  []json.RawMessage
+	Errors []apiErrorPayload
+}
+
+// executeBatcher накапливает одновременные вызовы API и отправляет их пачками
+// до maxExecuteCalls через VKScript-метод execute.
+type executeBatcher struct {
+	vk *VKClient
+	// ctx — контекст запросов execute и задержек между повторами: пачка не зависит
+	// от отмены отдельного вызова, но прерывается при завершении работы клиента.
+	ctx context.Context
+
+	mu      sync.Mutex
+	pending []*batchCall
+	timer   *time.Timer
+}
+
+func newExecuteBatcher(ctx context.Context, vk *VKClient) *executeBatcher {
+	return &executeBatcher{vk: vk, ctx: ctx}
+}
+
+// call ставит вызов в очередь и ждёт его результат. Пачка отправляется, когда
+// набирается maxExecuteCalls вызовов или истекает vk.BatchWindow с первого вызова.
+func (b *executeBatcher) call(ctx context.Context, method string, params url.Values, response interface{}) error {
+	c := &batchCall{
+		ctx:    ctx,
+		method: method,
+		params: params,
+		result: make(chan batchResult, 1),
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, c)
+	if len(b.pending) >= maxExecuteCalls {
+		batch := b.take()
+		go b.run(batch)
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(b.vk.BatchWindow, b.flush)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-c.result:
+		if res.err != nil {
+			return res.err
+		}
+		if err := json.Unmarshal(res.raw, response); err != nil {
+			return fmt.Errorf("json decode %s: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// take забирает накопленную пачку. Вызывается под b.mu.
+func (b *executeBatcher) take() []*batchCall {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+func (b *executeBatcher) flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	if len(batch) > 0 {
+		b.run(batch)
+	}
+}
+
+// run выполняет пачку и раздаёт результаты вызывающим. Вызовы, чей контекст
+// уже отменён, из пачки исключаются; вызовы, завершившиеся временной ошибкой
+// VK API, повторяются с той же задержкой, что и в makeVKRequest.
+func (b *executeBatcher) run(batch []*batchCall) {
+	for attempt := 0; ; attempt++ {
+		batch = live(batch)
+		if len(batch) == 0 {
+			return
+		}
+		if len(batch) == 1 {
+			// Одиночный вызов повторяет сам makeVKRequest.
+			var raw json.RawMessage
+			err := b.vk.makeVKRequest(batch[0].ctx, batch[0].method, batch[0].params, &raw)
+			batch[0].result <- batchResult{raw: raw, err: err}
+			return
+		}
+
+		failed := b.execute(batch)
+		if len(failed) == 0 {
+			return
+		}
+		if attempt >= b.vk.MaxRetries {
+			logrus.WithFields(logrus.Fields{
+				"calls":    len(failed),
+				"attempts": attempt + 1,
+			}).Error("Исчерпаны попытки повтора вызовов из пачки execute")
+			for _, c := range failed {
+				c.result <- batchResult{err: c.err}
+			}
+			return
+		}
+
+		delay := backoff(attempt, b.vk.RetryBaseDelay, b.vk.RetryMaxDelay)
+		logrus.WithFields(logrus.Fields{
+			"calls":   len(failed),
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+			"error":   failed[0].err,
+		}).Warning("Временная ошибка вызовов из пачки execute, повтор")
+		if err := sleep(b.ctx, delay); err != nil {
+			for _, c := range failed {
+				c.result <- batchResult{err: err}
+			}
+			return
+		}
+		batch = failed
+	}
+}
+
+// execute отправляет пачку одним запросом execute в контексте батчера и раздаёт
+// результаты. Вызовы с временной ошибкой не получают результат: они возвращаются
+// для повтора, а ошибка сохраняется в их поле err.
+func (b *executeBatcher) execute(batch []*batchCall) []*batchCall {
+	code, err := executeCode(batch)
+	if err != nil {
+		for _, c := range batch {
+			c.result <- batchResult{err: err}
+		}
+		return nil
+	}
+
+	params := url.Values{}
+	params.Set("code", code)
+
+	var result executeResult
+	err = b.vk.makeVKRequest(b.ctx, "execute", params, &result)
+	if err == nil && len(result.Items) != len(batch) {
+		err = fmt.Errorf("execute returned %d results for %d calls", len(result.Items), len(batch))
+	}
+	if err != nil {
+		for _, c := range batch {
+			c.result <- batchResult{err: err}
+		}
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"calls":  len(batch),
+		"failed": len(result.Errors),
+	}).Debug("Выполнена пачка вызовов через execute")
+
+	var failed []*batchCall
+	nextErr := 0
+	for i, c := range batch {
+		raw := result.Items[i]
+		if string(raw) != "false" {
+			c.result <- batchResult{raw: raw}
+			continue
+		}
+		if nextErr < len(result.Errors) {
+			apiErr := result.Errors[nextErr].toAPIError(c.method)
+			nextErr++
+			if IsTransient(apiErr) {
+				c.err = apiErr
+				failed = append(failed, c)
+				continue
+			}
+			c.result <- batchResult{err: apiErr}
+			continue
+		}
+		c.result <- batchResult{err: fmt.Errorf("execute: call %s failed without error", c.method)}
+	}
+	return failed
+}
+
+// live исключает из пачки вызовы, чей контекст уже отменён, и отдаёт им ошибку контекста.
+func live(batch []*batchCall) []*batchCall {
+	alive := batch[:0]
+	for _, c := range batch {
+		if err := c.ctx.Err(); err != nil {
+			c.result <- batchResult{err: err}
+			continue
+		}
+		alive = append(alive, c)
+	}
+	return alive
+}
+
+// executeCode собирает VKScript, возвращающий массив результатов вызовов пачки.
+func executeCode(batch []*batchCall) (string, error) {
+	calls := make([]string, len(batch))
+	for i, c := range batch {
+		args := make(map[string]string, len(c.params))
+		for key := range c.params {
+			args[key] = c.params.Get(key)
+		}
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			return "", fmt.Errorf("encode %s params: %w", c.method, err)
+		}
+		calls[i] = fmt.Sprintf("API.%s(%s)", c.method, encoded)
+	}
+	return fmt.Sprintf("return [%s];", strings.Join(calls, ",")), nil
+}
@@ -0,0 +1,63 @@
+package clients
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+)
+
+// groupFields — поля сообщества, запрашиваемые в groups.getById.
+const groupFields = "members_count,activity,type,is_closed,verified,city,description,site"
+
+// vkGroup — объект сообщества в ответах VK API.
+type vkGroup struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	ScreenName   string `json:"screen_name"`
+	MembersCount int    `json:"members_count"`
+	Activity     string `json:"activity"`
+	Type         string `json:"type"`
+	IsClosed     int    `json:"is_closed"`
+	Verified     int    `json:"verified"`
+	City         struct {
+		Title string `json:"title"`
+	} `json:"city"`
+	Description string `json:"description"`
+	Site        string `json:"site"`
+}
+
+func (g vkGroup) toModel() models.Group {
+	return models.Group{
+		ID:           g.ID,
+		ScreenName:   g.ScreenName,
+		Name:         g.Name,
+		MembersCount: g.MembersCount,
+		Activity:     g.Activity,
+		Type:         g.Type,
+		IsClosed:     g.IsClosed,
+		Verified:     g.Verified == 1,
+		City:         g.City.Title,
+		Description:  g.Description,
+		Site:         g.Site,
+	}
+}
+
+// GetGroupMembers возвращает участников группы, но не больше limit (0 — все).
+func (vk *VKClient) GetGroupMembers(ctx context.Context, groupID int, limit int) ([]models.User, error) {
+	params := url.Values{}
+	params.Set("group_id", strconv.Itoa(groupID))
+	params.Set("fields", listUserFields)
+
+	items, err := paginate[vkUser](ctx, vk, "groups.getMembers", params, groupMembersPageSize, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]models.User, 0, len(items))
+	for _, item := range items {
+		members = append(members, item.toModel())
+	}
+	return members, nil
+}
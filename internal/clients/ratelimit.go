@@ -0,0 +1,88 @@
+package clients
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// rateLimiter — потокобезопасный token bucket, ограничивающий частоту запросов к VK API.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter создаёт лимитер на rps запросов в секунду. При rps <= 0 ограничение отключено.
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait блокируется до получения токена и возвращает время ожидания.
+func (l *rateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	if l == nil || l.rate <= 0 {
+		return 0, ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// Возвращаем неиспользованный токен, чтобы не задерживать остальных.
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return 0, ctx.Err()
+	case <-timer.C:
+		return wait, nil
+	}
+}
+
+// backoff возвращает задержку перед повтором attempt (с нуля): экспоненциальный рост
+// от base до max со случайным разбросом в верхней половине интервала.
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base << attempt
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// sleep ждёт d или отмены контекста.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
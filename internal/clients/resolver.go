@@ -0,0 +1,163 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+)
+
+// prefixedIDPattern — адреса страниц по ID: id1 для пользователя, club1, public1 и event1 для группы.
+var prefixedIDPattern = regexp.MustCompile(`^(id|club|public|event)(\d+)$`)
+
+// vkHosts — хосты, ссылки на которые принимает ResolveSeed.
+var vkHosts = map[string]bool{
+	"vk.com":   true,
+	"m.vk.com": true,
+	"vk.ru":    true,
+	"m.vk.ru":  true,
+}
+
+// ResolveSeed превращает введённую строку в узел, с которого начинается обход.
+// Принимаются self, числовой ID (пользователь или группа, по numericKind;
+// отрицательный ID всегда обозначает группу), адреса id1, club1, public1, event1,
+// короткие имена и ссылки на vk.com. Короткие имена разрешаются через utils.resolveScreenName.
+func (vk *VKClient) ResolveSeed(ctx context.Context, value string, numericKind models.NodeKind) (models.NodeRef, error) {
+	name, err := screenNameOf(value)
+	if err != nil {
+		return models.NodeRef{}, err
+	}
+
+	if name == "self" {
+		userID, err := vk.GetCurrentUserID(ctx)
+		if err != nil {
+			return models.NodeRef{}, err
+		}
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			return models.NodeRef{}, fmt.Errorf("invalid current user id %s: %w", userID, err)
+		}
+		return models.UserRef(id), nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		switch {
+		case id < 0:
+			return models.GroupRef(-id), nil
+		case id == 0:
+			return models.NodeRef{}, fmt.Errorf("invalid id %s", value)
+		case numericKind == models.NodeGroup:
+			return models.GroupRef(id), nil
+		default:
+			return models.UserRef(id), nil
+		}
+	}
+
+	if match := prefixedIDPattern.FindStringSubmatch(name); match != nil {
+		id, _ := strconv.Atoi(match[2])
+		if match[1] == "id" {
+			return models.UserRef(id), nil
+		}
+		return models.GroupRef(id), nil
+	}
+
+	return vk.resolveScreenName(ctx, name)
+}
+
+// ResolveSeedOf разрешает строку, как ResolveSeed, но принимает только узел вида kind:
+// короткое имя или адрес группы там, где ожидается пользователь (и наоборот), — ошибка.
+func (vk *VKClient) ResolveSeedOf(ctx context.Context, value string, kind models.NodeKind) (models.NodeRef, error) {
+	seed, err := vk.ResolveSeed(ctx, value, kind)
+	if err != nil {
+		return models.NodeRef{}, err
+	}
+	if seed.Kind != kind {
+		return models.NodeRef{}, fmt.Errorf("%s resolves to %s, not a %s",
+			value, strings.ToLower(seed.String()), strings.ToLower(string(kind)))
+	}
+	return seed, nil
+}
+
+// screenNameOf извлекает короткое имя или ID из строки: ссылки на vk.com
+// сводятся к первому сегменту пути, символ @ в начале отбрасывается.
+func screenNameOf(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	// Короткие имена не содержат косой черты, поэтому всё с ней считается ссылкой.
+	if strings.Contains(value, "/") {
+		if !strings.Contains(value, "://") {
+			value = "https://" + value
+		}
+		u, err := url.Parse(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid vk url %s: %w", value, err)
+		}
+		if !vkHosts[strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))] {
+			return "", fmt.Errorf("not a vk url: %s", value)
+		}
+		value, _, _ = strings.Cut(strings.Trim(u.Path, "/"), "/")
+	}
+
+	value = strings.TrimPrefix(value, "@")
+	if value == "" {
+		return "", fmt.Errorf("empty user or group id")
+	}
+	return strings.ToLower(value), nil
+}
+
+// resolveScreenName определяет по короткому имени, пользователь это или группа.
+func (vk *VKClient) resolveScreenName(ctx context.Context, name string) (models.NodeRef, error) {
+	params := url.Values{}
+	params.Set("screen_name", name)
+
+	// Для неизвестного имени VK возвращает пустой массив вместо объекта.
+	var response json.RawMessage
+
+	// Выполняем запрос
+	if err := vk.callAPI(ctx, "utils.resolveScreenName", params, &response); err != nil {
+		return models.NodeRef{}, err
+	}
+
+	var object struct {
+		Type     string `json:"type"`
+		ObjectID int    `json:"object_id"`
+	}
+	if err := json.Unmarshal(response, &object); err != nil || object.ObjectID == 0 {
+		return models.NodeRef{}, fmt.Errorf("screen name %s not found", name)
+	}
+
+	switch object.Type {
+	case "user":
+		return models.UserRef(object.ObjectID), nil
+	case "group", "page", "event":
+		return models.GroupRef(object.ObjectID), nil
+	default:
+		return models.NodeRef{}, fmt.Errorf("screen name %s is a %s, not a user or group", name, object.Type)
+	}
+}
+
+// DescribeSeed возвращает имя пользователя или название группы, с которых начинается обход.
+func (vk *VKClient) DescribeSeed(ctx context.Context, seed models.NodeRef) (string, error) {
+	switch seed.Kind {
+	case models.NodeUser:
+		user, err := vk.GetUserFullData(ctx, seed.ID)
+		if err != nil {
+			return "", err
+		}
+		return user.Name, nil
+	case models.NodeGroup:
+		groups, err := vk.GetGroupsByID(ctx, []int{seed.ID})
+		if err != nil {
+			return "", err
+		}
+		if len(groups) == 0 {
+			return "", fmt.Errorf("group %d not found", seed.ID)
+		}
+		return groups[0].Name, nil
+	}
+	return "", fmt.Errorf("unsupported seed %s", seed)
+}
@@ -0,0 +1,196 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+)
+
+// newTestClient возвращает клиент, который обращается к поддельному VK API: короткие имена
+// durov и apiclub известны, users.get и groups.getById отвечают одной записью.
+func newTestClient(t *testing.T) *VKClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		var response string
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "utils.resolveScreenName":
+			switch r.Form.Get("screen_name") {
+			case "durov":
+				response = `{"type": "user", "object_id": 1}`
+			case "apiclub":
+				response = `{"type": "group", "object_id": 1}`
+			case "vkapp":
+				response = `{"type": "application", "object_id": 7}`
+			default:
+				response = `[]`
+			}
+		case "users.get":
+			id := r.Form.Get("user_ids")
+			if id == "" {
+				id = "5"
+			}
+			response = fmt.Sprintf(`[{"id": %s, "first_name": "Pavel", "last_name": "Durov"}]`, id)
+		case "groups.getById":
+			response = fmt.Sprintf(`[{"id": %s, "name": "VK API"}]`, r.Form.Get("group_ids"))
+		default:
+			t.Errorf("unexpected method %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"response": %s}`, response)
+	}))
+	t.Cleanup(server.Close)
+
+	vk := NewVKClient(context.Background(), "token")
+	vk.BaseURL = server.URL + "/"
+	vk.BatchWindow = 0
+	vk.MaxRetries = 0
+	vk.SetRateLimit(0)
+	return vk
+}
+
+func TestScreenNameOf(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{value: "durov", want: "durov"},
+		{value: "  Durov ", want: "durov"},
+		{value: "@durov", want: "durov"},
+		{value: "id123", want: "id123"},
+		{value: "https://vk.com/durov", want: "durov"},
+		{value: "vk.com/durov", want: "durov"},
+		{value: "https://www.vk.com/durov/", want: "durov"},
+		{value: "https://m.vk.com/club1?w=wall-1_1", want: "club1"},
+		{value: "http://vk.ru/public1#top", want: "public1"},
+		{value: "https://vk.com/id1/photos", want: "id1"},
+		{value: "https://example.com/durov", wantErr: "not a vk url"},
+		{value: "example.com/durov", wantErr: "not a vk url"},
+		{value: "https://vk.com/", wantErr: "empty user or group id"},
+		{value: "@", wantErr: "empty user or group id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := screenNameOf(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("screenNameOf(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("screenNameOf(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSeed(t *testing.T) {
+	vk := newTestClient(t)
+	tests := []struct {
+		value       string
+		numericKind models.NodeKind
+		want        models.NodeRef
+		wantErr     string
+	}{
+		{value: "123", numericKind: models.NodeUser, want: models.UserRef(123)},
+		{value: "123", numericKind: models.NodeGroup, want: models.GroupRef(123)},
+		{value: "-123", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "0", numericKind: models.NodeUser, wantErr: "invalid id 0"},
+		{value: "id123", numericKind: models.NodeGroup, want: models.UserRef(123)},
+		{value: "club123", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "public123", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "event123", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "https://vk.com/id123", numericKind: models.NodeUser, want: models.UserRef(123)},
+		{value: "vk.com/club123", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "https://vk.com/club123/", numericKind: models.NodeUser, want: models.GroupRef(123)},
+		{value: "https://vk.com/durov?from=search", numericKind: models.NodeUser, want: models.UserRef(1)},
+		{value: "@durov", numericKind: models.NodeUser, want: models.UserRef(1)},
+		{value: "apiclub", numericKind: models.NodeUser, want: models.GroupRef(1)},
+		{value: "self", numericKind: models.NodeUser, want: models.UserRef(5)},
+		{value: "nobody", numericKind: models.NodeUser, wantErr: "screen name nobody not found"},
+		{value: "vkapp", numericKind: models.NodeUser, wantErr: "is a application, not a user or group"},
+		{value: "https://example.com/id1", numericKind: models.NodeUser, wantErr: "not a vk url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+"/"+string(tt.numericKind), func(t *testing.T) {
+			got, err := vk.ResolveSeed(context.Background(), tt.value, tt.numericKind)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveSeed(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveSeed(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSeedOf(t *testing.T) {
+	vk := newTestClient(t)
+	tests := []struct {
+		value   string
+		kind    models.NodeKind
+		want    models.NodeRef
+		wantErr string
+	}{
+		{value: "durov", kind: models.NodeUser, want: models.UserRef(1)},
+		{value: "apiclub", kind: models.NodeGroup, want: models.GroupRef(1)},
+		{value: "1", kind: models.NodeGroup, want: models.GroupRef(1)},
+		{value: "apiclub", kind: models.NodeUser, wantErr: "apiclub resolves to group:1, not a user"},
+		{value: "club1", kind: models.NodeUser, wantErr: "club1 resolves to group:1, not a user"},
+		{value: "-1", kind: models.NodeUser, wantErr: "-1 resolves to group:1, not a user"},
+		{value: "durov", kind: models.NodeGroup, wantErr: "durov resolves to user:1, not a group"},
+		{value: "id1", kind: models.NodeGroup, wantErr: "id1 resolves to user:1, not a group"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+"/"+string(tt.kind), func(t *testing.T) {
+			got, err := vk.ResolveSeedOf(context.Background(), tt.value, tt.kind)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ResolveSeedOf(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveSeedOf(%q) = %s, %v, want %s", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeSeed(t *testing.T) {
+	vk := newTestClient(t)
+	tests := []struct {
+		seed    models.NodeRef
+		want    string
+		wantErr string
+	}{
+		{seed: models.UserRef(1), want: "Pavel Durov"},
+		{seed: models.GroupRef(1), want: "VK API"},
+		{seed: models.NodeRef{Kind: "Post", ID: 1}, wantErr: "unsupported seed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.seed.String(), func(t *testing.T) {
+			got, err := vk.DescribeSeed(context.Background(), tt.seed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("DescribeSeed(%s) error = %v, want %q", tt.seed, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("DescribeSeed(%s) = %q, %v, want %q", tt.seed, got, err, tt.want)
+			}
+		})
+	}
+}
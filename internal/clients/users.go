@@ -0,0 +1,89 @@
+package clients
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+)
+
+// userFields — поля профиля, запрашиваемые для раскрываемых пользователей.
+const userFields = "followers_count,city,home_town,sex,screen_name,bdate,country,is_closed," +
+	"deactivated,last_seen,verified,photo_200,education,occupation"
+
+// listUserFields — поля пользователей в списках друзей и фолловеров.
+const listUserFields = "screen_name,city,home_town,sex"
+
+// vkUser — объект пользователя в ответах VK API.
+type vkUser struct {
+	ID         int    `json:"id"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	ScreenName string `json:"screen_name"`
+	Sex        int    `json:"sex"`
+	City       struct {
+		Title string `json:"title"`
+	} `json:"city"`
+	HomeTown  string `json:"home_town"`
+	BirthDate string `json:"bdate"`
+	Country   struct {
+		Title string `json:"title"`
+	} `json:"country"`
+	FollowersCount  int    `json:"followers_count"`
+	IsClosed        bool   `json:"is_closed"`
+	CanAccessClosed bool   `json:"can_access_closed"`
+	Deactivated     string `json:"deactivated"`
+	LastSeen        struct {
+		Time int64 `json:"time"`
+	} `json:"last_seen"`
+	Verified       int    `json:"verified"`
+	Photo200       string `json:"photo_200"`
+	UniversityName string `json:"university_name"`
+	FacultyName    string `json:"faculty_name"`
+	Graduation     int    `json:"graduation"`
+	Occupation     struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"occupation"`
+}
+
+func (u vkUser) toModel() models.User {
+	city := u.City.Title
+	if city == "" {
+		city = u.HomeTown
+	}
+
+	user := models.User{
+		ID:             u.ID,
+		ScreenName:     u.ScreenName,
+		Name:           fmt.Sprintf("%s %s", u.FirstName, u.LastName),
+		Sex:            u.Sex,
+		City:           city,
+		BirthDate:      u.BirthDate,
+		Country:        u.Country.Title,
+		FollowersCount: u.FollowersCount,
+		IsClosed:       u.IsClosed,
+		Deactivated:    u.Deactivated,
+		Verified:       u.Verified == 1,
+		Photo:          u.Photo200,
+		University:     u.UniversityName,
+		Faculty:        u.FacultyName,
+		Graduation:     u.Graduation,
+		OccupationType: u.Occupation.Type,
+		OccupationName: u.Occupation.Name,
+	}
+	switch {
+	case u.Deactivated == "banned":
+		user.Status = models.StatusBanned
+	case u.Deactivated != "":
+		user.Status = models.StatusDeleted
+	case u.IsClosed && !u.CanAccessClosed:
+		user.Status = models.StatusPrivate
+	default:
+		user.Status = models.StatusActive
+	}
+	if u.LastSeen.Time > 0 {
+		user.LastSeen = time.Unix(u.LastSeen.Time, 0).UTC()
+	}
+	return user
+}
@@ -9,45 +9,137 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/checkpoint"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/config"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	friendsPageSize       = 5000
+	followersPageSize     = 1000
+	subscriptionsPageSize = 200
+	groupsByIDBatchSize   = 500
+	groupMembersPageSize  = 1000
+)
+
 type VKClient struct {
 	AccessToken string
 	BaseURL     string
 	Client      *http.Client
+	// MaxRetries — число повторов запроса при временных ошибках VK API и HTTP 5xx.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// BatchWindow — сколько ждать одновременных вызовов, чтобы объединить их
+	// в один запрос execute. 0 отключает объединение.
+	BatchWindow time.Duration
+	// Checkpointer, если задан, сохраняет состояние обхода в CollectData.
+	Checkpointer *checkpoint.Checkpointer
+
+	limiter  *rateLimiter
+	batcher  *executeBatcher
+	requests atomic.Int64
 }
 
-func NewVKClient(accessToken string) *VKClient {
-	return &VKClient{
-		AccessToken: accessToken,
-		BaseURL:     "https://api.vk.com/method/",
-		Client:      &http.Client{},
+// NewVKClient создаёт клиент VK API. ctx ограничивает запросы, которые клиент выполняет
+// сразу для нескольких вызовов (пачки execute и их повторы): после отмены ctx они прерываются.
+func NewVKClient(ctx context.Context, accessToken string) *VKClient {
+	vk := &VKClient{
+		AccessToken:    accessToken,
+		BaseURL:        "https://api.vk.com/method/",
+		Client:         &http.Client{},
+		MaxRetries:     config.DefaultVKMaxRetries,
+		RetryBaseDelay: config.DefaultVKRetryBaseDelay,
+		RetryMaxDelay:  config.DefaultVKRetryMaxDelay,
+		BatchWindow:    config.DefaultVKBatchWindow,
+		limiter:        newRateLimiter(config.DefaultVKRequestsPerSecond, 1),
 	}
+	vk.batcher = newExecuteBatcher(ctx, vk)
+	return vk
+}
+
+// SetRateLimit задаёт допустимое число запросов к VK API в секунду. При rps <= 0 ограничение отключается.
+func (vk *VKClient) SetRateLimit(rps float64) {
+	vk.limiter = newRateLimiter(rps, 1)
 }
 
-type VKError struct {
-	Error struct {
-		ErrorCode     int    `json:"error_code"`
-		ErrorMsg      string `json:"error_msg"`
-		RequestParams []struct {
-			Key   string `json:"key"`
-			Value string `json:"value"`
-		} `json:"request_params"`
-	} `json:"error"`
+// RequestCount возвращает число HTTP-запросов к VK API, выполненных клиентом.
+func (vk *VKClient) RequestCount() int64 {
+	return vk.requests.Load()
 }
 
-// makeVKRequest выполняет GET-запрос к VK API и декодирует ответ.
+// callAPI выполняет вызов метода API. Если включено объединение, вызов
+// отправляется пачкой вместе с одновременными вызовами из других горутин.
+func (vk *VKClient) callAPI(ctx context.Context, method string, params url.Values, response interface{}) error {
+	if vk.BatchWindow > 0 {
+		return vk.batcher.call(ctx, method, params, response)
+	}
+	return vk.makeVKRequest(ctx, method, params, response)
+}
+
+// makeVKRequest выполняет запрос к VK API с учётом ограничения частоты и
+// повторяет его с экспоненциальной задержкой при временных ошибках.
+// Содержимое поля response ответа декодируется в response, а поле error
+// возвращается как *APIError.
 func (vk *VKClient) makeVKRequest(ctx context.Context, method string, params url.Values, response interface{}) error {
 	params.Set("access_token", vk.AccessToken)
 	params.Set("v", config.VKAPIVersion)
 
-	fullURL := fmt.Sprintf("%s%s?%s", vk.BaseURL, method, params.Encode())
+	var totalWait time.Duration
+	for attempt := 0; ; attempt++ {
+		waited, err := vk.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		totalWait += waited
+
+		err = vk.doVKRequest(ctx, method, params, response)
+		if err == nil {
+			if attempt > 0 {
+				logrus.WithFields(logrus.Fields{
+					"method":     method,
+					"attempts":   attempt + 1,
+					"total_wait": totalWait.String(),
+				}).Info("VK API запрос выполнен после повторов")
+			}
+			return nil
+		}
+		if !IsTransient(err) || attempt >= vk.MaxRetries {
+			if IsTransient(err) {
+				logrus.WithFields(logrus.Fields{
+					"method":     method,
+					"attempts":   attempt + 1,
+					"total_wait": totalWait.String(),
+				}).Error("Исчерпаны попытки повтора VK API запроса")
+			}
+			return err
+		}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
+		delay := backoff(attempt, vk.RetryBaseDelay, vk.RetryMaxDelay)
+		logrus.WithFields(logrus.Fields{
+			"method":     method,
+			"attempt":    attempt + 1,
+			"delay":      delay.String(),
+			"total_wait": totalWait.String(),
+			"error":      err,
+		}).Warning("Временная ошибка VK API, повтор запроса")
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		totalWait += delay
+	}
+}
+
+// doVKRequest выполняет одну попытку запроса и декодирует ответ.
+func (vk *VKClient) doVKRequest(ctx context.Context, method string, params url.Values, response interface{}) error {
+	// Параметры передаются в теле POST-запроса: код execute не помещается в URL.
+	fullURL := vk.BaseURL + method
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fullURL, strings.NewReader(params.Encode()))
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"method": method,
@@ -56,7 +148,9 @@ func (vk *VKClient) makeVKRequest(ctx context.Context, method string, params url
 		}).Error("Не удалось создать HTTP-запрос")
 		return fmt.Errorf("create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
+	vk.requests.Add(1)
 	resp, err := vk.Client.Do(req)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
@@ -84,10 +178,25 @@ func (vk *VKClient) makeVKRequest(ctx context.Context, method string, params url
 			"status_code": resp.StatusCode,
 			"body":        string(bodyBytes),
 		}).Error("Неправильный статус код от VK API")
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": method,
+			"url":    fullURL,
+			"error":  err,
+		}).Error("Ошибка чтения ответа от VK API")
+		return fmt.Errorf("read body: %w", err)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+	var envelope struct {
+		Response      json.RawMessage   `json:"response"`
+		Error         *apiErrorPayload  `json:"error"`
+		ExecuteErrors []apiErrorPayload `json:"execute_errors"`
+	}
+	if err := json.Unmarshal(bodyBytes, &envelope); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"method": method,
 			"url":    fullURL,
@@ -96,281 +205,205 @@ func (vk *VKClient) makeVKRequest(ctx context.Context, method string, params url
 		return fmt.Errorf("json decode: %w", err)
 	}
 
-	if vkErr, ok := response.(*VKError); ok && vkErr.Error.ErrorCode != 0 {
+	if envelope.Error != nil && envelope.Error.ErrorCode != 0 {
+		apiErr := envelope.Error.toAPIError(method)
 		logrus.WithFields(logrus.Fields{
 			"method":     method,
-			"url":        fullURL,
-			"error_code": vkErr.Error.ErrorCode,
-			"error_msg":  vkErr.Error.ErrorMsg,
-		}).Error("VK API вернул ошибку")
-		return fmt.Errorf("vk api error %d: %s", vkErr.Error.ErrorCode, vkErr.Error.ErrorMsg)
+			"error_code": apiErr.Code,
+			"error_msg":  apiErr.Message,
+			"params":     apiErr.RequestParams,
+		}).Debug("VK API вернул ошибку")
+		return apiErr
 	}
-	return nil
-}
 
-// GetCurrentUserID возвращает ID текущего пользователя.
-func (vk *VKClient) GetCurrentUserID(ctx context.Context) (string, error) {
-	params := url.Values{}
+	// Для execute ошибки отдельных вызовов лежат рядом с response.
+	if result, ok := response.(*executeResult); ok {
+		result.Errors = envelope.ExecuteErrors
+		response = &result.Items
+	}
 
-	type UsersGetResponse struct {
-		Response []struct {
-			ID int `json:"id"`
-		} `json:"response"`
-		Error VKError `json:"error"`
+	if err := json.Unmarshal(envelope.Response, response); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"method": method,
+			"url":    fullURL,
+			"error":  err,
+		}).Error("Ошибка декодирования JSON ответа от VK API")
+		return fmt.Errorf("json decode: %w", err)
 	}
 
-	var response UsersGetResponse
+	return nil
+}
 
-	err := vk.makeVKRequest(ctx, "users.get", params, &response)
-	if err != nil {
-		return "", err
+// paginate постранично запрашивает списочный метод VK API, пока не будут получены
+// все элементы (по полю count ответа) или не будет достигнут limit (0 — без ограничения).
+func paginate[T any](ctx context.Context, vk *VKClient, method string, params url.Values, pageSize, limit int) ([]T, error) {
+	type pageResponse struct {
+		Count int `json:"count"`
+		Items []T `json:"items"`
 	}
 
-	if len(response.Response) == 0 {
-		return "", fmt.Errorf("empty response")
-	}
+	var items []T
+	pages, total := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
-	userID := strconv.Itoa(response.Response[0].ID)
-	logrus.Infof("Получен ID текущего пользователя: %s", userID)
-	return userID, nil
-}
+		count := pageSize
+		if limit > 0 && limit-len(items) < count {
+			count = limit - len(items)
+		}
 
-// CollectData собирает данные о пользователе, его фолловерах и подписках до заданной глубины.
-func (vk *VKClient) CollectData(ctx context.Context, userID string, depth int) (*models.Data, error) {
-	logrus.Infof("Начало сбора данных для пользователя ID: %s с глубиной: %d", userID, depth)
-	data := &models.Data{
-		Users:         make(map[int]models.User),
-		Groups:        make(map[int]models.Group),
-		Relationships: []models.Relationship{},
-	}
-	visitedUsers := make(map[int]bool)
-	id, err := strconv.Atoi(userID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid userID: %w", err)
-	}
-	err = vk.collectUserData(ctx, id, data, visitedUsers, depth)
-	if err != nil {
-		return nil, err
-	}
-	logrus.Infof("Сбор данных для пользователя ID: %s завершен успешно", userID)
-	return data, nil
-}
+		pageParams := url.Values{}
+		for key, values := range params {
+			pageParams[key] = values
+		}
+		pageParams.Set("offset", strconv.Itoa(len(items)))
+		pageParams.Set("count", strconv.Itoa(count))
 
-// collectUserData рекурсивно собирает данные пользователя.
-func (vk *VKClient) collectUserData(ctx context.Context, userID int, data *models.Data, visitedUsers map[int]bool, depth int) error {
-	if depth == 0 {
-		return nil
-	}
-	if visitedUsers[userID] {
-		return nil
-	}
-	visitedUsers[userID] = true
+		var response pageResponse
+		if err := vk.callAPI(ctx, method, pageParams, &response); err != nil {
+			return nil, err
+		}
+		pages++
+		total = response.Count
+		items = append(items, response.Items...)
 
-	// Получаем информацию о пользователе
-	userInfo, err := vk.GetUserFullData(ctx, userID)
-	if err != nil {
-		logrus.Errorf("Ошибка получения данных пользователя ID: %d: %v", userID, err)
-		return fmt.Errorf("get user info (%d): %v", userID, err)
+		if len(response.Items) == 0 || len(items) >= total {
+			break
+		}
+		if limit > 0 && len(items) >= limit {
+			break
+		}
 	}
-	data.Users[userID] = userInfo
 
-	// Получаем фолловеров
-	followers, err := vk.GetFollowers(ctx, userID)
-	if err != nil {
-		logrus.Errorf("Ошибка получения фолловеров пользователя ID: %d: %v", userID, err)
-		return fmt.Errorf("get user followers (%d): %v", userID, err)
+	entry := logrus.WithFields(logrus.Fields{
+		"method":  method,
+		"pages":   pages,
+		"fetched": len(items),
+		"total":   total,
+		"capped":  len(items) < total,
+	})
+	for _, key := range []string{"user_id", "group_id"} {
+		if value := params.Get(key); value != "" {
+			entry = entry.WithField(key, value)
+		}
 	}
-
-	// Получаем подписки
-	subscriptions, err := vk.GetSubscriptions(ctx, userID)
-	if err != nil {
-		logrus.Errorf("Ошибка получения подписок пользователя ID: %d: %v", userID, err)
-		return fmt.Errorf("get user subscriptions (%d): %v", userID, err)
+	if len(items) < total {
+		entry.Info("Постраничная выборка остановлена по лимиту")
+	} else {
+		entry.Debug("Постраничная выборка завершена")
 	}
 
-	// Обработка фолловеров
-	for _, follower := range followers {
-		data.Relationships = append(data.Relationships, models.Relationship{
-			From: follower.ID,
-			To:   userID,
-			Type: "FOLLOWS",
-		})
+	return items, nil
+}
 
-		// Рекурсивный вызов для фолловера
-		err = vk.collectUserData(ctx, follower.ID, data, visitedUsers, depth-1)
-		if err != nil {
-			logrus.Errorf("Ошибка рекурсивного сбора данных для пользователя ID: %d: %v", follower.ID, err)
-			// Продолжаем сбор данных для остальных фолловеров
-		}
+// GetCurrentUserID возвращает ID текущего пользователя.
+func (vk *VKClient) GetCurrentUserID(ctx context.Context) (string, error) {
+	params := url.Values{}
+
+	var response []struct {
+		ID int `json:"id"`
 	}
 
-	// Обработка подписок
-	for _, subscription := range subscriptions {
-		if strings.ToLower(subscription.Type) == "page" || strings.ToLower(subscription.Type) == "group" {
-			groupID := -subscription.ID
-			data.Groups[groupID] = models.Group{
-				ID:         subscription.ID,
-				Name:       subscription.Name,
-				ScreenName: subscription.ScreenName,
-			}
+	err := vk.callAPI(ctx, "users.get", params, &response)
+	if err != nil {
+		return "", err
+	}
 
-			data.Relationships = append(data.Relationships, models.Relationship{
-				From: userID,
-				To:   groupID,
-				Type: "SUBSCRIBES",
-			})
-		} else if strings.ToLower(subscription.Type) == "profile" {
-			data.Relationships = append(data.Relationships, models.Relationship{
-				From: userID,
-				To:   subscription.ID,
-				Type: "SUBSCRIBES",
-			})
-
-			err = vk.collectUserData(ctx, subscription.ID, data, visitedUsers, depth-1)
-			if err != nil {
-				logrus.Errorf("Ошибка рекурсивного сбора данных для подписки пользователя ID: %d: %v", subscription.ID, err)
-				// Продолжаем сбор данных для остальных подписок
-			}
-		}
+	if len(response) == 0 {
+		return "", fmt.Errorf("empty response")
 	}
 
-	return nil
+	userID := strconv.Itoa(response[0].ID)
+	logrus.Infof("Получен ID текущего пользователя: %s", userID)
+	return userID, nil
 }
 
 // GetUserFullData возвращает полные данные пользователя.
 func (vk *VKClient) GetUserFullData(ctx context.Context, userID int) (models.User, error) {
 	params := url.Values{}
 	params.Set("user_ids", strconv.Itoa(userID))
-	params.Set("fields", "followers_count,city,home_town,sex,screen_name")
-
-	// Определяем структуру ответа
-	type UserFullDataResponse struct {
-		Response []struct {
-			ID         int    `json:"id"`
-			FirstName  string `json:"first_name"`
-			LastName   string `json:"last_name"`
-			ScreenName string `json:"screen_name"`
-			Sex        int    `json:"sex"`
-			City       struct {
-				Title string `json:"title"`
-			} `json:"city"`
-			HomeTown string `json:"home_town"`
-		} `json:"response"`
-		Error VKError `json:"error"`
-	}
+	params.Set("fields", userFields)
 
-	var response UserFullDataResponse
+	var response []vkUser
 
 	// Выполняем запрос
-	err := vk.makeVKRequest(ctx, "users.get", params, &response)
+	err := vk.callAPI(ctx, "users.get", params, &response)
 	if err != nil {
 		return models.User{}, err
 	}
 
-	if len(response.Response) == 0 {
+	if len(response) == 0 {
 		logrus.Error("Получен пустой ответ от VK API в GetUserFullData")
 		return models.User{}, fmt.Errorf("empty response")
 	}
 
-	user := response.Response[0]
-	city := user.City.Title
-	if city == "" {
-		city = user.HomeTown
+	return response[0].toModel(), nil
+}
+
+// GetFriends возвращает список друзей пользователя, но не более limit (0 — все).
+func (vk *VKClient) GetFriends(ctx context.Context, userID int, limit int) ([]models.User, error) {
+	params := url.Values{}
+	params.Set("user_id", strconv.Itoa(userID))
+	params.Set("fields", listUserFields)
+
+	// Выполняем запросы
+	items, err := paginate[vkUser](ctx, vk, "friends.get", params, friendsPageSize, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	userModel := models.User{
-		ID:         user.ID,
-		ScreenName: user.ScreenName,
-		Name:       fmt.Sprintf("%s %s", user.FirstName, user.LastName),
-		Sex:        user.Sex,
-		City:       city,
+	friends := make([]models.User, len(items))
+	for i, item := range items {
+		friends[i] = item.toModel()
 	}
 
-	return userModel, nil
+	return friends, nil
 }
 
-// GetFollowers возвращает список фолловеров пользователя.
-func (vk *VKClient) GetFollowers(ctx context.Context, userID int) ([]models.User, error) {
+// GetFollowers возвращает список фолловеров пользователя, но не более limit (0 — все).
+func (vk *VKClient) GetFollowers(ctx context.Context, userID int, limit int) ([]models.User, error) {
 	params := url.Values{}
 	params.Set("user_id", strconv.Itoa(userID))
-	params.Set("fields", "screen_name,city,home_town,sex")
-	params.Set("count", "200")
-
-	// Определяем структуру ответа
-	type GetFollowersResponse struct {
-		Response struct {
-			Items []struct {
-				ID         int    `json:"id"`
-				FirstName  string `json:"first_name"`
-				LastName   string `json:"last_name"`
-				ScreenName string `json:"screen_name"`
-				Sex        int    `json:"sex"`
-				City       struct {
-					Title string `json:"title"`
-				} `json:"city"`
-				HomeTown string `json:"home_town"`
-			} `json:"items"`
-		} `json:"response"`
-		Error VKError `json:"error"`
-	}
+	params.Set("fields", listUserFields)
 
-	var response GetFollowersResponse
-
-	// Выполняем запрос
-	err := vk.makeVKRequest(ctx, "users.getFollowers", params, &response)
+	// Выполняем запросы
+	items, err := paginate[vkUser](ctx, vk, "users.getFollowers", params, followersPageSize, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	followers := make([]models.User, len(response.Response.Items))
-	for i, item := range response.Response.Items {
-		city := item.City.Title
-		if city == "" {
-			city = item.HomeTown
-		}
-		followers[i] = models.User{
-			ID:         item.ID,
-			ScreenName: item.ScreenName,
-			Name:       fmt.Sprintf("%s %s", item.FirstName, item.LastName),
-			Sex:        item.Sex,
-			City:       city,
-		}
+	followers := make([]models.User, len(items))
+	for i, item := range items {
+		followers[i] = item.toModel()
 	}
 
 	return followers, nil
 }
 
-// GetSubscriptions возвращает список подписок пользователя.
-func (vk *VKClient) GetSubscriptions(ctx context.Context, userID int) ([]models.Subscription, error) {
+// GetSubscriptions возвращает список подписок пользователя, но не более limit (0 — все).
+func (vk *VKClient) GetSubscriptions(ctx context.Context, userID int, limit int) ([]models.Subscription, error) {
 	params := url.Values{}
 	params.Set("user_id", strconv.Itoa(userID))
 	params.Set("extended", "1")
-	params.Set("count", "200")
 	params.Set("fields", "screen_name,city,home_town,sex")
 
-	// Определяем структуру ответа
-	type GetSubscriptionsResponse struct {
-		Response struct {
-			Items []struct {
-				ID         int    `json:"id"`
-				Name       string `json:"name"`
-				ScreenName string `json:"screen_name"`
-				Type       string `json:"type"`
-			} `json:"items"`
-		} `json:"response"`
-		Error VKError `json:"error"`
+	type subscriptionItem struct {
+		ID         int    `json:"id"`
+		Name       string `json:"name"`
+		ScreenName string `json:"screen_name"`
+		Type       string `json:"type"`
 	}
 
-	var response GetSubscriptionsResponse
-
-	// Выполняем запрос
-	err := vk.makeVKRequest(ctx, "users.getSubscriptions", params, &response)
+	// Выполняем запросы
+	items, err := paginate[subscriptionItem](ctx, vk, "users.getSubscriptions", params, subscriptionsPageSize, limit)
 	if err != nil {
 		return nil, err
 	}
 
-	subscriptions := make([]models.Subscription, len(response.Response.Items))
-	for i, item := range response.Response.Items {
+	subscriptions := make([]models.Subscription, len(items))
+	for i, item := range items {
 		subscriptions[i] = models.Subscription{
 			ID:         item.ID,
 			Name:       item.Name,
@@ -381,3 +414,29 @@ func (vk *VKClient) GetSubscriptions(ctx context.Context, userID int) ([]models.
 
 	return subscriptions, nil
 }
+
+// GetGroupsByID возвращает данные групп по их ID, запрашивая до 500 групп за вызов.
+func (vk *VKClient) GetGroupsByID(ctx context.Context, groupIDs []int) ([]models.Group, error) {
+	groups := make([]models.Group, 0, len(groupIDs))
+	for start := 0; start < len(groupIDs); start += groupsByIDBatchSize {
+		ids := make([]string, 0, groupsByIDBatchSize)
+		for _, id := range groupIDs[start:min(start+groupsByIDBatchSize, len(groupIDs))] {
+			ids = append(ids, strconv.Itoa(id))
+		}
+
+		params := url.Values{}
+		params.Set("group_ids", strings.Join(ids, ","))
+		params.Set("fields", groupFields)
+
+		var response []vkGroup
+
+		// Выполняем запрос
+		if err := vk.callAPI(ctx, "groups.getById", params, &response); err != nil {
+			return nil, err
+		}
+		for _, group := range response {
+			groups = append(groups, group.toModel())
+		}
+	}
+	return groups, nil
+}
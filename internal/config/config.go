@@ -1,6 +1,26 @@
 package config
 
+import "time"
+
 const (
 	VKAPIVersion   = "5.131"
 	DefaultEnvFile = ".env"
+
+	DefaultCrawlDepth              = 2
+	DefaultCrawlExpand             = "followers,subscriptions"
+	DefaultMaxFriendsPerUser       = 1000
+	DefaultMaxFollowersPerUser     = 1000
+	DefaultMaxSubscriptionsPerUser = 1000
+	DefaultMaxMembers              = 1000
+	DefaultCrawlWorkers            = 4
+	DefaultCheckpointInterval      = 30 * time.Second
+
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 5 * time.Second
+
+	DefaultVKRequestsPerSecond = 3
+	DefaultVKMaxRetries        = 5
+	DefaultVKRetryBaseDelay    = 500 * time.Millisecond
+	DefaultVKRetryMaxDelay     = 30 * time.Second
+	DefaultVKBatchWindow       = 50 * time.Millisecond
 )
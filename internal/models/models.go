@@ -1,5 +1,12 @@
 package models
 
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
 // User представляет пользователя VK.
 type User struct {
 	ID         int
@@ -7,13 +14,55 @@ type User struct {
 	Name       string
 	Sex        int
 	City       string
+	// BirthDate — дата рождения в формате VK: D.M.YYYY или D.M, если год скрыт.
+	BirthDate      string
+	Country        string
+	FollowersCount int
+	IsClosed       bool
+	// Deactivated — deleted или banned для удалённых и заблокированных страниц.
+	Deactivated    string
+	LastSeen       time.Time
+	Verified       bool
+	Photo          string
+	University     string
+	Faculty        string
+	Graduation     int
+	OccupationType string
+	OccupationName string
+	Status         UserStatus
+}
+
+// StatusOnly сообщает, что о пользователе известны только ID и статус профиля:
+// так передаются закрытые, удалённые и заблокированные профили.
+func (u User) StatusOnly() bool {
+	return u == User{ID: u.ID, Status: u.Status}
 }
 
+// UserStatus — доступность профиля пользователя. Раскрываются только активные профили.
+type UserStatus string
+
+const (
+	StatusActive  UserStatus = "active"
+	StatusPrivate UserStatus = "private"
+	StatusDeleted UserStatus = "deleted"
+	StatusBanned  UserStatus = "banned"
+)
+
 // Group представляет группу VK.
 type Group struct {
-	ID         int
-	ScreenName string
-	Name       string
+	ID           int
+	ScreenName   string
+	Name         string
+	MembersCount int
+	Activity     string
+	// Type — group, page или event.
+	Type string
+	// IsClosed — 0 для открытой, 1 для закрытой и 2 для частной группы.
+	IsClosed    int
+	Verified    bool
+	City        string
+	Description string
+	Site        string
 }
 
 // Subscription представляет подписку пользователя.
@@ -24,16 +73,279 @@ type Subscription struct {
 	Type       string
 }
 
-// Relationship представляет связь между пользователями или группами.
+// NodeKind — вид узла графа. Значение совпадает с меткой узла в Neo4j.
+type NodeKind string
+
+const (
+	NodeUser  NodeKind = "User"
+	NodeGroup NodeKind = "Group"
+)
+
+// Valid сообщает, что вид узла известен. В запросы к Neo4j попадают только известные метки.
+func (k NodeKind) Valid() bool {
+	switch k {
+	case NodeUser, NodeGroup:
+		return true
+	}
+	return false
+}
+
+// NodeRef — ссылка на узел графа: вид узла и его ID в VK.
+type NodeRef struct {
+	Kind NodeKind
+	ID   int
+}
+
+// UserRef возвращает ссылку на пользователя.
+func UserRef(id int) NodeRef {
+	return NodeRef{Kind: NodeUser, ID: id}
+}
+
+// GroupRef возвращает ссылку на группу.
+func GroupRef(id int) NodeRef {
+	return NodeRef{Kind: NodeGroup, ID: id}
+}
+
+func (r NodeRef) String() string {
+	return fmt.Sprintf("%s:%d", r.Kind, r.ID)
+}
+
+// RelationshipType — тип связи. Значение совпадает с типом связи в Neo4j.
+type RelationshipType string
+
+const (
+	// RelFollows — пользователь подписан на пользователя (фолловер или подписка на профиль).
+	RelFollows RelationshipType = "FOLLOWS"
+	// RelSubscribes — пользователь подписан на группу.
+	RelSubscribes RelationshipType = "SUBSCRIBES"
+	// RelFriends — пользователи дружат. Связь взаимна и хранится одним ребром
+	// от меньшего ID к большему; в запросах её направление не учитывается.
+	RelFriends RelationshipType = "FRIENDS"
+	// RelMemberOf — пользователь состоит в группе, с которой начат обход.
+	RelMemberOf RelationshipType = "MEMBER_OF"
+)
+
+// Valid сообщает, что тип связи известен. В запросы к Neo4j попадают только известные типы.
+func (t RelationshipType) Valid() bool {
+	switch t {
+	case RelFollows, RelSubscribes, RelFriends, RelMemberOf:
+		return true
+	}
+	return false
+}
+
+// Relationship представляет связь между узлами графа.
 type Relationship struct {
-	From int
-	To   int
-	Type string
+	From NodeRef
+	To   NodeRef
+	Type RelationshipType
+}
+
+// EdgeDirection — направление связей набора относительно его владельца.
+type EdgeDirection string
+
+const (
+	DirectionOut EdgeDirection = "out"
+	DirectionIn  EdgeDirection = "in"
+	// DirectionBoth — направление не учитывается (связь FRIENDS).
+	DirectionBoth EdgeDirection = "both"
+)
+
+// EdgeSet — полный набор связей одного вида у пользователя, полученный в текущем обходе:
+// связи типа Type в направлении Direction с узлами вида Other, ID которых перечислены в IDs.
+// В режиме обновления хранилище закрывает сохранённые связи этого вида, которых нет в наборе.
+type EdgeSet struct {
+	Owner     NodeRef
+	Type      RelationshipType
+	Direction EdgeDirection
+	Other     NodeKind
+	IDs       []int
+}
+
+// SeedDistance — исходный узел обхода и число шагов, за которое обход от него дошёл до узла.
+type SeedDistance struct {
+	Seed     NodeRef
+	Distance int
 }
 
 // Data представляет собранные данные.
 type Data struct {
+	// RunID — запуск обхода, в котором собраны данные; записывается в last_run_id.
+	RunID         string
 	Users         map[int]User
 	Groups        map[int]Group
 	Relationships []Relationship
+	// Reach — от каких исходных узлов и на каком расстоянии обход дошёл до узла.
+	Reach map[NodeRef][]SeedDistance
+	// EdgeSets — полные наборы связей для сверки с хранилищем в режиме обновления.
+	EdgeSets []EdgeSet
+}
+
+// Sink принимает сущности по мере их сбора. Методы могут блокироваться,
+// пока получатель не освободится, и должны быть безопасны для конкурентного вызова.
+type Sink interface {
+	AddUser(ctx context.Context, user User) error
+	AddGroup(ctx context.Context, group Group) error
+	AddRelationship(ctx context.Context, rel Relationship) error
+	// AddReach заменяет сведения о том, от каких исходных узлов обход дошёл до node.
+	AddReach(ctx context.Context, node NodeRef, seeds []SeedDistance) error
+	// AddEdgeSet передаёт полный набор связей для сверки. Набор нужно передать
+	// раньше самих связей, иначе новые связи не попадут в сводку изменений.
+	AddEdgeSet(ctx context.Context, set EdgeSet) error
+	// Sync дожидается, пока всё переданное в sink до вызова будет записано.
+	Sync(ctx context.Context) error
+}
+
+// StreamWriter — Sink, который пишет сущности в хранилище пачками.
+// Close дожидается записи всего принятого и возвращает итог.
+type StreamWriter interface {
+	Sink
+	Close() (WriteSummary, error)
+}
+
+// WriteSummary — число записанных в хранилище сущностей.
+type WriteSummary struct {
+	Users         int
+	Groups        int
+	Relationships int
+	Batches       int
+}
+
+// CrawlStats — итог обхода.
+type CrawlStats struct {
+	Seeds int
+	// Expanded — пользователи, взятые в раскрытие, включая недоступные профили.
+	Expanded int
+	Private  int
+	Deleted  int
+	Banned   int
+	// Failed — пользователи, при сборе данных которых произошла ошибка.
+	Failed int
+	// Requests — запросы к VK API в текущем запуске, без запросов до продолжения обхода.
+	Requests int64
+	// Exhausted — исчерпанный бюджет (max_users или max_requests); пусто, если обход завершён.
+	Exhausted string
+}
+
+// RunOutcome — итог запуска обхода.
+type RunOutcome string
+
+const (
+	RunRunning   RunOutcome = "running"
+	RunCompleted RunOutcome = "completed"
+	// RunExhausted — обход остановлен по исчерпании бюджета.
+	RunExhausted RunOutcome = "budget_exhausted"
+	RunCanceled  RunOutcome = "canceled"
+	RunFailed    RunOutcome = "failed"
+)
+
+// CrawlRun — запуск обхода. Время начала и окончания записывает хранилище.
+type CrawlRun struct {
+	ID      string
+	Seeds   []NodeRef
+	Options CrawlOptions
+	Stats   CrawlStats
+	Outcome RunOutcome
+	// Error — текст ошибки, если запуск завершился неудачно.
+	Error string
+}
+
+// RunRef указывает запуск обхода: по идентификатору или, если ID пуст, как последний
+// запуск, завершившийся не позже At.
+type RunRef struct {
+	ID string
+	At time.Time
+}
+
+func (r RunRef) String() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.At.Format(time.RFC3339)
+}
+
+// ParseTime разбирает момент времени: дату (полночь по местному времени) или время в формате RFC 3339.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected date (2006-01-02) or RFC 3339 time: %s", value)
+	}
+	return t, nil
+}
+
+// DiffRun — запуск обхода, с состоянием графа на момент окончания которого идёт сравнение.
+type DiffRun struct {
+	ID         string    `json:"id"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// NodeDiff — узел, появившийся в графе или выпавший из него.
+type NodeDiff struct {
+	Label string `json:"label"`
+	ID    int64  `json:"id"`
+	Name  string `json:"name,omitempty"`
+}
+
+// EdgeDiff — связь, появившаяся или исчезнувшая между запусками.
+type EdgeDiff struct {
+	Type      string `json:"type"`
+	FromLabel string `json:"from_label"`
+	FromID    int64  `json:"from_id"`
+	ToLabel   string `json:"to_label"`
+	ToID      int64  `json:"to_id"`
+}
+
+// PropertyDiff — изменение свойства узла между запусками.
+type PropertyDiff struct {
+	Label     string    `json:"label"`
+	ID        int64     `json:"id"`
+	Property  string    `json:"property"`
+	Old       any       `json:"old"`
+	New       any       `json:"new"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// GraphDiff — изменения графа между окончаниями двух запусков обхода.
+type GraphDiff struct {
+	From         DiffRun        `json:"from"`
+	To           DiffRun        `json:"to"`
+	AddedNodes   []NodeDiff     `json:"added_nodes"`
+	RemovedNodes []NodeDiff     `json:"removed_nodes"`
+	ChangedNodes []PropertyDiff `json:"changed_nodes"`
+	AddedEdges   []EdgeDiff     `json:"added_edges"`
+	RemovedEdges []EdgeDiff     `json:"removed_edges"`
+}
+
+// EdgeKind — вид связей пользователя, которые краулер запрашивает и раскрывает.
+type EdgeKind string
+
+const (
+	EdgeFriends       EdgeKind = "friends"
+	EdgeFollowers     EdgeKind = "followers"
+	EdgeSubscriptions EdgeKind = "subscriptions"
+)
+
+// CrawlOptions задаёт глубину и ограничения обхода графа.
+// Нулевое значение ограничения означает его отсутствие.
+type CrawlOptions struct {
+	Depth                   int
+	Expand                  []EdgeKind
+	MaxUsers                int
+	MaxFriendsPerUser       int
+	MaxFollowersPerUser     int
+	MaxSubscriptionsPerUser int
+	// MaxMembers ограничивает число участников исходной группы.
+	MaxMembers  int
+	MaxRequests int
+	Workers     int
+	// Resume продолжает обход с сохранённого состояния.
+	Resume bool
+}
+
+// Expands сообщает, что обход запрашивает и раскрывает связи вида kind.
+func (o CrawlOptions) Expands(kind EdgeKind) bool {
+	return slices.Contains(o.Expand, kind)
 }
@@ -0,0 +1,9 @@
+// name: city_users
+// description: пользователи из города city
+// param: city string | город, как он записан в графе
+// param: limit int >= 1 = 100 | максимальное число строк
+// columns: user_id, user_name, screen_name, status
+MATCH (u:User {city: $city})
+RETURN u.id AS user_id, u.name AS user_name, u.screen_name AS screen_name, u.status AS status
+ORDER BY u.id
+LIMIT $limit
@@ -0,0 +1,10 @@
+// name: closed_relationships
+// description: последние закрытые связи: отписки, удаления из друзей, выходы из групп
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: from_label, from_id, type, to_label, to_id, valid_from, valid_to
+MATCH (a)-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]->(b)
+WHERE r.valid_to IS NOT NULL
+RETURN labels(a)[0] AS from_label, a.id AS from_id, type(r) AS type,
+	labels(b)[0] AS to_label, b.id AS to_id, r.valid_from AS valid_from, r.valid_to AS valid_to
+ORDER BY r.valid_to DESC
+LIMIT $limit
@@ -0,0 +1,9 @@
+// name: crawl_runs
+// description: последние запуски обхода: исходные узлы, глубина, время, итог и число запросов
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: run_id, seeds, depth, started_at, finished_at, outcome, requests, expanded
+MATCH (r:CrawlRun)
+RETURN r.id AS run_id, r.seeds AS seeds, r.depth AS depth, r.started_at AS started_at,
+	r.finished_at AS finished_at, r.outcome AS outcome, r.requests AS requests, r.expanded AS expanded
+ORDER BY r.started_at DESC
+LIMIT $limit
@@ -0,0 +1,9 @@
+// name: graph_as_of
+// description: все связи, действовавшие на момент as_of, с интервалами действия
+// param: as_of datetime = now | момент, на который восстанавливается граф: дата, время в формате RFC 3339 или now
+// columns: from_label, from_id, type, to_label, to_id, valid_from, valid_to
+MATCH (a)-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]->(b)
+WHERE (r.valid_from IS NULL OR r.valid_from <= $as_of) AND (r.valid_to IS NULL OR r.valid_to > $as_of)
+RETURN labels(a)[0] AS from_label, a.id AS from_id, type(r) AS type,
+	labels(b)[0] AS to_label, b.id AS to_id, r.valid_from AS valid_from, r.valid_to AS valid_to
+ORDER BY type, from_id, to_id
@@ -0,0 +1,8 @@
+// name: graph_stats_as_of
+// description: число связей каждого типа на момент as_of
+// param: as_of datetime = now | момент, на который восстанавливается граф: дата, время в формате RFC 3339 или now
+// columns: type, relationships_count
+MATCH ()-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]->()
+WHERE (r.valid_from IS NULL OR r.valid_from <= $as_of) AND (r.valid_to IS NULL OR r.valid_to > $as_of)
+RETURN type(r) AS type, COUNT(r) AS relationships_count
+ORDER BY type
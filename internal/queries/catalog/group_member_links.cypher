@@ -0,0 +1,9 @@
+// name: group_member_links
+// description: участники группы с наибольшим числом друзей и подписок среди других участников той же группы
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: group_name, user_id, user_name, links_count
+MATCH (g:Group)<-[m1:MEMBER_OF]-(u:User)-[r:FRIENDS|FOLLOWS]-(v:User)-[m2:MEMBER_OF]->(g)
+WHERE m1.valid_to IS NULL AND r.valid_to IS NULL AND m2.valid_to IS NULL
+RETURN g.name AS group_name, u.id AS user_id, u.name AS user_name, COUNT(DISTINCT v) AS links_count
+ORDER BY links_count DESC
+LIMIT $limit
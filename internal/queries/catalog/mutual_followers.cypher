@@ -0,0 +1,7 @@
+// name: mutual_followers
+// description: пары пользователей, подписанных друг на друга
+// columns: user1_id, user2_id
+MATCH (u1:User)-[r1:FOLLOWS]->(u2:User)
+MATCH (u2)-[r2:FOLLOWS]->(u1)
+WHERE r1.valid_to IS NULL AND r2.valid_to IS NULL
+RETURN u1.id AS user1_id, u2.id AS user2_id
@@ -0,0 +1,11 @@
+// name: mutual_friends
+// description: общие друзья пользователей user1_id и user2_id
+// param: user1_id int >= 1 | ID первого пользователя VK
+// param: user2_id int >= 1 | ID второго пользователя VK
+// param: limit int >= 1 = 100 | максимальное число строк
+// columns: friend_id, friend_name
+MATCH (u1:User {id: $user1_id})-[r1:FRIENDS]-(f:User)-[r2:FRIENDS]-(u2:User {id: $user2_id})
+WHERE r1.valid_to IS NULL AND r2.valid_to IS NULL AND f <> u1 AND f <> u2
+RETURN DISTINCT f.id AS friend_id, f.name AS friend_name
+ORDER BY friend_id
+LIMIT $limit
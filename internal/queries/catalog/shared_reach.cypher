@@ -0,0 +1,9 @@
+// name: shared_reach
+// description: пользователи, до которых обход дошёл от наибольшего числа исходных узлов
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, user_name, seed_ids, seed_distances
+MATCH (u:User)
+WHERE size(u.seed_ids) > 1
+RETURN u.id AS user_id, u.name AS user_name, u.seed_ids AS seed_ids, u.seed_distances AS seed_distances
+ORDER BY size(u.seed_ids) DESC, reduce(total = 0, d IN u.seed_distances | total + d) ASC
+LIMIT $limit
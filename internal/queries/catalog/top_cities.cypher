@@ -0,0 +1,12 @@
+// name: top_cities
+// description: самые популярные города среди пользователей
+// param: limit int >= 1 = 5 | максимальное число строк
+// param: min_count int >= 0 = 1 | минимальное число пользователей в городе
+// columns: city, user_count
+MATCH (u:User)
+WHERE u.city IS NOT NULL
+WITH u.city AS city, COUNT(u) AS user_count
+WHERE user_count >= $min_count
+RETURN city, user_count
+ORDER BY user_count DESC
+LIMIT $limit
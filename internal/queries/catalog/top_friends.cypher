@@ -0,0 +1,9 @@
+// name: top_friends
+// description: пользователи с наибольшим количеством друзей
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, friends_count
+MATCH (u:User)-[r:FRIENDS]-(f:User)
+WHERE r.valid_to IS NULL
+RETURN u.id AS user_id, COUNT(DISTINCT f) AS friends_count
+ORDER BY friends_count DESC
+LIMIT $limit
@@ -0,0 +1,9 @@
+// name: top_groups
+// description: группы с наибольшим количеством подписчиков среди собранных пользователей и размер их аудитории
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: group_name, subscribers_count, members_count
+MATCH (g:Group)<-[r:SUBSCRIBES]-(u:User)
+WHERE r.valid_to IS NULL
+RETURN g.name AS group_name, COUNT(u) AS subscribers_count, g.members_count AS members_count
+ORDER BY subscribers_count DESC
+LIMIT $limit
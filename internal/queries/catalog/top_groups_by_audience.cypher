@@ -0,0 +1,13 @@
+// name: top_groups_by_audience
+// description: группы с наибольшей долей собранных пользователей среди всей аудитории группы (members_count)
+// param: limit int >= 1 = 5 | максимальное число строк
+// param: min_count int >= 0 = 1 | минимальное число собранных подписчиков группы
+// columns: group_name, subscribers_count, members_count, audience_share
+MATCH (g:Group)<-[r:SUBSCRIBES]-(u:User)
+WHERE g.members_count > 0 AND r.valid_to IS NULL
+WITH g, COUNT(u) AS subscribers_count
+WHERE subscribers_count >= $min_count
+RETURN g.name AS group_name, subscribers_count, g.members_count AS members_count,
+	toFloat(subscribers_count) / g.members_count AS audience_share
+ORDER BY audience_share DESC, subscribers_count DESC
+LIMIT $limit
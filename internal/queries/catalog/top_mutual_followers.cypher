@@ -0,0 +1,10 @@
+// name: top_mutual_followers
+// description: пользователи с наибольшим числом общих подписчиков с другими пользователями
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, mutual_followers_count
+MATCH (u1:User)<-[r1:FOLLOWS]-(mutualFollower)-[r2:FOLLOWS]->(u2:User)
+WHERE u1 <> u2 AND r1.valid_to IS NULL AND r2.valid_to IS NULL
+WITH u1, COUNT(DISTINCT mutualFollower) AS mutual_followers_count
+RETURN u1.id AS user_id, mutual_followers_count
+ORDER BY mutual_followers_count DESC
+LIMIT $limit
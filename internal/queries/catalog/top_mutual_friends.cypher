@@ -0,0 +1,12 @@
+// name: top_mutual_friends
+// description: пары пользователей с наибольшим числом общих друзей
+// param: limit int >= 1 = 5 | максимальное число строк
+// param: min_count int >= 0 = 1 | минимальное число общих друзей
+// columns: user1_id, user2_id, mutual_friends_count
+MATCH (u1:User)-[r1:FRIENDS]-(mutualFriend:User)-[r2:FRIENDS]-(u2:User)
+WHERE u1.id < u2.id AND r1.valid_to IS NULL AND r2.valid_to IS NULL
+WITH u1, u2, COUNT(DISTINCT mutualFriend) AS mutual_friends_count
+WHERE mutual_friends_count >= $min_count
+RETURN u1.id AS user1_id, u2.id AS user2_id, mutual_friends_count
+ORDER BY mutual_friends_count DESC
+LIMIT $limit
@@ -0,0 +1,9 @@
+// name: top_subscribers
+// description: пользователи с наибольшим числом подписок на группы
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, subscription_count
+MATCH (u:User)-[r:SUBSCRIBES]->(g:Group)
+WHERE r.valid_to IS NULL
+RETURN u.id AS user_id, COUNT(g) AS subscription_count
+ORDER BY subscription_count DESC
+LIMIT $limit
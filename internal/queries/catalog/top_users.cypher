@@ -0,0 +1,9 @@
+// name: top_users
+// description: пользователи с наибольшим количеством подписчиков
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, followers_count
+MATCH (u:User)<-[r:FOLLOWS]-(f:User)
+WHERE r.valid_to IS NULL
+RETURN u.id AS user_id, COUNT(f) AS followers_count
+ORDER BY followers_count DESC
+LIMIT $limit
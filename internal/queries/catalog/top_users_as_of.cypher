@@ -0,0 +1,10 @@
+// name: top_users_as_of
+// description: пользователи с наибольшим количеством подписчиков на момент as_of
+// param: as_of datetime = now | момент, на который восстанавливается граф: дата, время в формате RFC 3339 или now
+// param: limit int >= 1 = 5 | максимальное число строк
+// columns: user_id, followers_count
+MATCH (u:User)<-[r:FOLLOWS]-(f:User)
+WHERE (r.valid_from IS NULL OR r.valid_from <= $as_of) AND (r.valid_to IS NULL OR r.valid_to > $as_of)
+RETURN u.id AS user_id, COUNT(f) AS followers_count
+ORDER BY followers_count DESC
+LIMIT $limit
@@ -0,0 +1,5 @@
+// name: total_groups
+// description: общее количество групп
+// columns: total_groups
+MATCH (g:Group)
+RETURN COUNT(g) AS total_groups
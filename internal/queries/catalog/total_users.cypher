@@ -0,0 +1,5 @@
+// name: total_users
+// description: общее количество пользователей
+// columns: total_users
+MATCH (u:User)
+RETURN COUNT(u) AS total_users
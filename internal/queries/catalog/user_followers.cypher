@@ -0,0 +1,10 @@
+// name: user_followers
+// description: фолловеры пользователя user_id, начиная с новых
+// param: user_id int >= 1 | ID пользователя VK
+// param: limit int >= 1 = 100 | максимальное число строк
+// columns: follower_id, follower_name, since
+MATCH (u:User {id: $user_id})<-[r:FOLLOWS]-(f:User)
+WHERE r.valid_to IS NULL
+RETURN f.id AS follower_id, f.name AS follower_name, r.valid_from AS since
+ORDER BY r.valid_from DESC, f.id
+LIMIT $limit
@@ -0,0 +1,7 @@
+// name: user_statuses
+// description: число пользователей по доступности профиля (active, private, deleted, banned)
+// columns: status, users_count
+MATCH (u:User)
+WHERE u.status IS NOT NULL
+RETURN u.status AS status, COUNT(u) AS users_count
+ORDER BY users_count DESC
@@ -0,0 +1,124 @@
+package queries
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+)
+
+// ParamType — тип параметра предопределённого запроса.
+type ParamType string
+
+const (
+	ParamInt    ParamType = "int"
+	ParamFloat  ParamType = "float"
+	ParamString ParamType = "string"
+	ParamBool   ParamType = "bool"
+	// ParamDateTime — дата (2024-10-30), время в формате RFC 3339 или now.
+	ParamDateTime ParamType = "datetime"
+)
+
+// Valid сообщает, что тип параметра поддерживается.
+func (t ParamType) Valid() bool {
+	switch t {
+	case ParamInt, ParamFloat, ParamString, ParamBool, ParamDateTime:
+		return true
+	}
+	return false
+}
+
+// Param описывает параметр предопределённого запроса. Пустой Default означает,
+// что параметр обязателен. Min — нижняя граница значения числового параметра (nil — без границы).
+type Param struct {
+	Name        string
+	Type        ParamType
+	Default     string
+	Min         *float64
+	Description string
+}
+
+// Parse приводит строковое значение параметра к его типу.
+func (p Param) Parse(value string) (any, error) {
+	switch p.Type {
+	case ParamInt:
+		return strconv.ParseInt(value, 10, 64)
+	case ParamFloat:
+		return strconv.ParseFloat(value, 64)
+	case ParamString:
+		return value, nil
+	case ParamBool:
+		return strconv.ParseBool(value)
+	case ParamDateTime:
+		if value == "now" {
+			return time.Now(), nil
+		}
+		return models.ParseTime(value)
+	}
+	return nil, fmt.Errorf("unsupported type %q", p.Type)
+}
+
+// Check проверяет, что приведённое значение не меньше Min.
+func (p Param) Check(value any) error {
+	if p.Min == nil {
+		return nil
+	}
+	var number float64
+	switch v := value.(type) {
+	case int64:
+		number = float64(v)
+	case float64:
+		number = v
+	default:
+		return nil
+	}
+	if number < *p.Min {
+		return fmt.Errorf("must be >= %s", strconv.FormatFloat(*p.Min, 'f', -1, 64))
+	}
+	return nil
+}
+
+// Query — предопределённый запрос к графу: текст на Cypher, параметры и столбцы результата.
+type Query struct {
+	Name        string
+	Description string
+	Params      []Param
+	Columns     []string
+	Cypher      string
+	// Source — файл, из которого загружен запрос.
+	Source string
+}
+
+// Bind проверяет параметры запроса, переданные строками, подставляет значения по умолчанию
+// и приводит значения к типам параметров.
+func (q Query) Bind(values map[string]string) (map[string]any, error) {
+	declared := make(map[string]bool, len(q.Params))
+	params := make(map[string]any, len(q.Params))
+	for _, param := range q.Params {
+		declared[param.Name] = true
+		value, ok := values[param.Name]
+		if !ok {
+			value = param.Default
+		}
+		if value == "" {
+			return nil, fmt.Errorf("missing required param %s", param.Name)
+		}
+		parsed, err := param.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid param %s=%s: expected %s", param.Name, value, param.Type)
+		}
+		if err := param.Check(parsed); err != nil {
+			return nil, fmt.Errorf("invalid param %s=%s: %v", param.Name, value, err)
+		}
+		params[param.Name] = parsed
+	}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if !declared[name] {
+			return nil, fmt.Errorf("unknown param %s", name)
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,232 @@
+package queries
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// catalog — встроенные запросы: по одному файлу .cypher на запрос.
+//
+//go:embed catalog/*.cypher
+var catalog embed.FS
+
+// paramPattern находит параметры $name в тексте запроса.
+var paramPattern = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// paramSpecPattern разбирает описание параметра без текста описания: имя, тип, минимум и значение по умолчанию.
+var paramSpecPattern = regexp.MustCompile(`^(\S+)\s+([a-z]+)\s*(?:>=\s*(\S+))?\s*(?:=\s*(.*))?$`)
+
+// Registry — каталог предопределённых запросов.
+type Registry struct {
+	queries map[string]Query
+}
+
+// builtin разбирает встроенный каталог один раз. Ошибка в нём — ошибка сборки, поэтому паника;
+// тест каталога ловит её раньше запуска программы.
+var builtin = sync.OnceValue(func() *Registry {
+	r, err := loadBuiltin()
+	if err != nil {
+		panic(fmt.Sprintf("load builtin queries: %v", err))
+	}
+	return r
+})
+
+// loadBuiltin разбирает встроенный каталог.
+func loadBuiltin() (*Registry, error) {
+	r := &Registry{queries: make(map[string]Query)}
+	if err := r.loadFS(catalog, "catalog", "builtin:"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Builtin возвращает каталог встроенных запросов.
+func Builtin() *Registry {
+	return builtin()
+}
+
+// Load возвращает встроенные запросы вместе с запросами из файлов .cypher каталога dir
+// (пустой dir — только встроенные). Запрос из dir заменяет встроенный с тем же именем.
+func Load(dir string) (*Registry, error) {
+	r := &Registry{queries: make(map[string]Query, len(builtin().queries))}
+	for name, query := range builtin().queries {
+		r.queries[name] = query
+	}
+	if dir == "" {
+		return r, nil
+	}
+	if err := r.loadFS(os.DirFS(dir), ".", dir+"/"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Get возвращает запрос по имени.
+func (r *Registry) Get(name string) (Query, bool) {
+	query, ok := r.queries[name]
+	return query, ok
+}
+
+// List возвращает все запросы, упорядоченные по имени.
+func (r *Registry) List() []Query {
+	list := make([]Query, 0, len(r.queries))
+	for _, query := range r.queries {
+		list = append(list, query)
+	}
+	slices.SortFunc(list, func(a, b Query) int { return strings.Compare(a.Name, b.Name) })
+	return list
+}
+
+// loadFS загружает все файлы .cypher из каталога dir файловой системы fsys;
+// prefix добавляется к имени файла в Query.Source.
+func (r *Registry) loadFS(fsys fs.FS, dir, prefix string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.cypher"))
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return fmt.Errorf("read query %s: %w", file, err)
+		}
+		source := prefix + path.Base(file)
+		query, err := Parse(strings.TrimSuffix(path.Base(file), ".cypher"), string(data))
+		if err != nil {
+			return fmt.Errorf("parse query %s: %w", source, err)
+		}
+		query.Source = source
+		if other, ok := seen[query.Name]; ok {
+			return fmt.Errorf("query %s is defined in both %s and %s", query.Name, other, source)
+		}
+		seen[query.Name] = source
+		if old, ok := r.queries[query.Name]; ok {
+			logrus.Infof("Запрос %s из %s заменяет запрос из %s", query.Name, source, old.Source)
+		}
+		r.queries[query.Name] = query
+	}
+	return nil
+}
+
+// Parse разбирает файл запроса. Файл начинается с заголовка из строк комментария Cypher
+// вида "// ключ: значение", за ним идёт текст запроса:
+//
+//	// name: top_users
+//	// description: пользователи с наибольшим числом фолловеров
+//	// param: limit int >= 1 = 5 | максимальное число строк
+//	// columns: user_id, followers_count
+//	MATCH ...
+//
+// Параметр без значения по умолчанию обязателен, ">= минимум" задаёт нижнюю границу
+// числового параметра; строка param повторяется для каждого параметра. Если name
+// не указан, именем служит defaultName.
+func Parse(defaultName, text string) (Query, error) {
+	query := Query{Name: defaultName}
+	lines := strings.Split(text, "\n")
+	body := len(lines)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		comment, ok := strings.CutPrefix(line, "//")
+		if !ok {
+			body = i
+			break
+		}
+		key, value, ok := strings.Cut(comment, ":")
+		if !ok {
+			return Query{}, fmt.Errorf("line %d: expected \"// key: value\"", i+1)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "name":
+			query.Name = value
+		case "description":
+			query.Description = value
+		case "param":
+			param, err := parseParam(value)
+			if err != nil {
+				return Query{}, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			query.Params = append(query.Params, param)
+		case "columns":
+			for _, column := range strings.Split(value, ",") {
+				if column = strings.TrimSpace(column); column != "" {
+					query.Columns = append(query.Columns, column)
+				}
+			}
+		default:
+			return Query{}, fmt.Errorf("line %d: unknown key %q", i+1, strings.TrimSpace(key))
+		}
+	}
+	query.Cypher = strings.TrimSpace(strings.Join(lines[body:], "\n"))
+
+	if query.Name == "" {
+		return Query{}, fmt.Errorf("empty query name")
+	}
+	if query.Cypher == "" {
+		return Query{}, fmt.Errorf("empty query text")
+	}
+	declared := make(map[string]bool, len(query.Params))
+	for _, param := range query.Params {
+		if declared[param.Name] {
+			return Query{}, fmt.Errorf("param %s is declared twice", param.Name)
+		}
+		declared[param.Name] = true
+	}
+	for _, match := range paramPattern.FindAllStringSubmatch(query.Cypher, -1) {
+		if !declared[match[1]] {
+			return Query{}, fmt.Errorf("param $%s is used but not declared", match[1])
+		}
+	}
+	return query, nil
+}
+
+// parseParam разбирает описание параметра вида "имя тип [>= минимум] [= значение] [| описание]".
+func parseParam(value string) (Param, error) {
+	spec, description, _ := strings.Cut(value, "|")
+	match := paramSpecPattern.FindStringSubmatch(strings.TrimSpace(spec))
+	if match == nil {
+		return Param{}, fmt.Errorf("param %q: expected \"name type [>= min] [= default] [| description]\"", value)
+	}
+	param := Param{
+		Name:        match[1],
+		Type:        ParamType(match[2]),
+		Default:     strings.TrimSpace(match[4]),
+		Description: strings.TrimSpace(description),
+	}
+	if !param.Type.Valid() {
+		return Param{}, fmt.Errorf("param %s: unsupported type %q", param.Name, param.Type)
+	}
+	if match[3] != "" {
+		if param.Type != ParamInt && param.Type != ParamFloat {
+			return Param{}, fmt.Errorf("param %s: min is only allowed for int and float", param.Name)
+		}
+		minValue, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("param %s: invalid min %q", param.Name, match[3])
+		}
+		param.Min = &minValue
+	}
+	if param.Default != "" {
+		parsed, err := param.Parse(param.Default)
+		if err != nil {
+			return Param{}, fmt.Errorf("param %s: invalid default %q", param.Name, param.Default)
+		}
+		if err := param.Check(parsed); err != nil {
+			return Param{}, fmt.Errorf("param %s: invalid default %q: %v", param.Name, param.Default, err)
+		}
+	}
+	return param, nil
+}
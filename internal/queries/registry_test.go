@@ -0,0 +1,208 @@
+package queries
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    Query
+		wantErr string
+	}{
+		{
+			name: "full header",
+			text: `// name: top_users
+// description: пользователи с наибольшим числом фолловеров
+// param: limit int >= 1 = 5 | максимальное число строк
+// param: city string | город
+// columns: user_id, followers_count
+MATCH (u:User {city: $city}) RETURN u.id AS user_id LIMIT $limit`,
+			want: Query{
+				Name:        "top_users",
+				Description: "пользователи с наибольшим числом фолловеров",
+				Params: []Param{
+					{Name: "limit", Type: ParamInt, Default: "5", Min: ptr(1.0), Description: "максимальное число строк"},
+					{Name: "city", Type: ParamString, Description: "город"},
+				},
+				Columns: []string{"user_id", "followers_count"},
+				Cypher:  "MATCH (u:User {city: $city}) RETURN u.id AS user_id LIMIT $limit",
+			},
+		},
+		{
+			name: "name from file",
+			text: "// description: все пользователи\n\nMATCH (u:User) RETURN count(u)",
+			want: Query{Name: "default", Description: "все пользователи", Cypher: "MATCH (u:User) RETURN count(u)"},
+		},
+		{
+			name: "default with spaces",
+			text: "// param: city string = Saint Petersburg\nMATCH (u:User {city: $city}) RETURN u",
+			want: Query{
+				Name:   "default",
+				Params: []Param{{Name: "city", Type: ParamString, Default: "Saint Petersburg"}},
+				Cypher: "MATCH (u:User {city: $city}) RETURN u",
+			},
+		},
+		{name: "unknown header key", text: "// author: me\nRETURN 1", wantErr: `line 1: unknown key "author"`},
+		{name: "header without key", text: "// just a comment\nRETURN 1", wantErr: "line 1: expected"},
+		{name: "duplicate param", text: "// param: limit int = 5\n// param: limit int = 10\nRETURN $limit", wantErr: "param limit is declared twice"},
+		{name: "undeclared param", text: "// param: limit int = 5\nRETURN $city LIMIT $limit", wantErr: "param $city is used but not declared"},
+		{name: "unsupported type", text: "// param: limit integer = 5\nRETURN $limit", wantErr: `unsupported type "integer"`},
+		{name: "invalid default", text: "// param: limit int = five\nRETURN $limit", wantErr: `invalid default "five"`},
+		{name: "default below min", text: "// param: limit int >= 1 = 0\nRETURN $limit", wantErr: `invalid default "0": must be >= 1`},
+		{name: "min on string", text: "// param: city string >= 1\nRETURN $city", wantErr: "min is only allowed for int and float"},
+		{name: "malformed param", text: "// param: limit\nRETURN $limit", wantErr: "expected \"name type"},
+		{name: "empty text", text: "// name: empty\n", wantErr: "empty query text"},
+		{name: "empty name", text: "// name:\nRETURN 1", wantErr: "empty query name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse("default", tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	query := Query{
+		Name: "q",
+		Params: []Param{
+			{Name: "limit", Type: ParamInt, Default: "5", Min: ptr(1.0)},
+			{Name: "ratio", Type: ParamFloat, Default: "0.5", Min: ptr(0.0)},
+			{Name: "city", Type: ParamString},
+			{Name: "closed", Type: ParamBool, Default: "false"},
+		},
+	}
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			values: map[string]string{"city": "Moscow"},
+			want:   map[string]any{"limit": int64(5), "ratio": 0.5, "city": "Moscow", "closed": false},
+		},
+		{
+			name:   "overrides",
+			values: map[string]string{"city": "Moscow", "limit": "10", "ratio": "0", "closed": "true"},
+			want:   map[string]any{"limit": int64(10), "ratio": 0.0, "city": "Moscow", "closed": true},
+		},
+		{name: "required param missing", values: map[string]string{}, wantErr: "missing required param city"},
+		{name: "required param empty", values: map[string]string{"city": ""}, wantErr: "missing required param city"},
+		{name: "unknown param", values: map[string]string{"city": "Moscow", "offset": "1"}, wantErr: "unknown param offset"},
+		{name: "wrong type", values: map[string]string{"city": "Moscow", "limit": "ten"}, wantErr: "invalid param limit=ten: expected int"},
+		{name: "negative limit", values: map[string]string{"city": "Moscow", "limit": "-1"}, wantErr: "invalid param limit=-1: must be >= 1"},
+		{name: "float below min", values: map[string]string{"city": "Moscow", "ratio": "-0.1"}, wantErr: "invalid param ratio=-0.1: must be >= 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := query.Bind(tt.values)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Bind error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Bind: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Bind = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestBuiltinCatalog проверяет встроенные файлы .cypher: ошибка в них иначе проявится
+// только паникой при запуске программы.
+func TestBuiltinCatalog(t *testing.T) {
+	r, err := loadBuiltin()
+	if err != nil {
+		t.Fatalf("load builtin queries: %v", err)
+	}
+	if len(r.List()) == 0 {
+		t.Fatal("builtin catalog is empty")
+	}
+	for _, query := range r.List() {
+		if query.Description == "" {
+			t.Errorf("query %s has no description", query.Name)
+		}
+		if len(query.Columns) == 0 {
+			t.Errorf("query %s has no columns", query.Name)
+		}
+		// Параметры со значением по умолчанию должны давать запрос без дополнительных значений.
+		values := make(map[string]string)
+		for _, param := range query.Params {
+			if param.Default == "" {
+				values[param.Name] = requiredValue(param)
+			}
+		}
+		if _, err := query.Bind(values); err != nil {
+			t.Errorf("query %s: %v", query.Name, err)
+		}
+	}
+}
+
+func TestLoadOverridesBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("total_users.cypher", "// description: свой подсчёт\n// columns: n\nMATCH (u:User) RETURN count(u) AS n")
+	write("mine.cypher", "// param: limit int >= 1 = 3\nMATCH (u:User) RETURN u LIMIT $limit")
+
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if query, _ := r.Get("total_users"); query.Description != "свой подсчёт" || query.Source != dir+"/total_users.cypher" {
+		t.Errorf("total_users = %+v, want override from %s", query, dir)
+	}
+	if _, ok := r.Get("mine"); !ok {
+		t.Error("query mine not loaded")
+	}
+	if _, ok := r.Get("top_users"); !ok {
+		t.Error("builtin query top_users lost")
+	}
+
+	write("broken.cypher", "// param: limit int = 5\nRETURN $offset")
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "broken.cypher") {
+		t.Errorf("Load error = %v, want error naming broken.cypher", err)
+	}
+}
+
+func requiredValue(param Param) string {
+	switch param.Type {
+	case ParamInt, ParamFloat:
+		return "1"
+	case ParamBool:
+		return "true"
+	case ParamDateTime:
+		return "now"
+	}
+	return "value"
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
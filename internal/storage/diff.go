@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sirupsen/logrus"
+)
+
+// Diff сравнивает граф на моменты окончания двух запусков обхода: узлы, впервые попавшие в граф
+// и выпавшие из него, изменения их свойств, появившиеся и исчезнувшие связи.
+// Запуск from должен завершиться раньше запуска to.
+func (s *Neo4jStorage) Diff(ctx context.Context, from, to models.RunRef) (*models.GraphDiff, error) {
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer func() {
+		if err := session.Close(ctx); err != nil {
+			logrus.Warnf("close session: %v", err)
+		}
+	}()
+
+	fromRun, err := s.findRun(ctx, session, from)
+	if err != nil {
+		return nil, err
+	}
+	toRun, err := s.findRun(ctx, session, to)
+	if err != nil {
+		return nil, err
+	}
+	if fromRun.FinishedAt.After(toRun.FinishedAt) {
+		return nil, fmt.Errorf("run %s finished after run %s", fromRun.ID, toRun.ID)
+	}
+
+	diff := &models.GraphDiff{From: fromRun, To: toRun}
+	params := map[string]any{"from": fromRun.FinishedAt, "to": toRun.FinishedAt}
+
+	records, err := readAll(ctx, session, diffAddedNodesQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("diff added nodes: %w", err)
+	}
+	diff.AddedNodes = nodeDiffs(records)
+
+	records, err = readAll(ctx, session, diffRemovedNodesQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("diff removed nodes: %w", err)
+	}
+	diff.RemovedNodes = nodeDiffs(records)
+
+	records, err = readAll(ctx, session, diffPropertiesQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("diff properties: %w", err)
+	}
+	for _, record := range records {
+		values := record.AsMap()
+		change := models.PropertyDiff{
+			Label:    asString(values["label"]),
+			ID:       asInt64(values["id"]),
+			Property: asString(values["property"]),
+			Old:      values["old_value"],
+			New:      values["new_value"],
+		}
+		change.ChangedAt, _ = values["changed_at"].(time.Time)
+		diff.ChangedNodes = append(diff.ChangedNodes, change)
+	}
+
+	records, err = readAll(ctx, session, diffEdgesQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("diff edges: %w", err)
+	}
+	for _, record := range records {
+		values := record.AsMap()
+		edge := models.EdgeDiff{
+			Type:      asString(values["type"]),
+			FromLabel: asString(values["from_label"]),
+			FromID:    asInt64(values["from_id"]),
+			ToLabel:   asString(values["to_label"]),
+			ToID:      asInt64(values["to_id"]),
+		}
+		if added, _ := values["added"].(bool); added {
+			diff.AddedEdges = append(diff.AddedEdges, edge)
+		} else {
+			diff.RemovedEdges = append(diff.RemovedEdges, edge)
+		}
+	}
+
+	return diff, nil
+}
+
+// findRun находит завершённый запуск обхода по идентификатору или по моменту времени.
+func (s *Neo4jStorage) findRun(ctx context.Context, session neo4j.SessionWithContext, ref models.RunRef) (models.DiffRun, error) {
+	query, params := findRunQuery, map[string]any{"id": ref.ID}
+	if ref.ID == "" {
+		query, params = findRunBeforeQuery, map[string]any{"at": ref.At}
+	}
+	records, err := readAll(ctx, session, query, params)
+	if err != nil {
+		return models.DiffRun{}, fmt.Errorf("find run %s: %w", ref, err)
+	}
+	if len(records) == 0 {
+		return models.DiffRun{}, fmt.Errorf("run %s not found", ref)
+	}
+
+	values := records[0].AsMap()
+	run := models.DiffRun{ID: asString(values["id"])}
+	finishedAt, ok := values["finished_at"].(time.Time)
+	if !ok {
+		return models.DiffRun{}, fmt.Errorf("run %s has not finished", run.ID)
+	}
+	run.FinishedAt = finishedAt
+	return run, nil
+}
+
+// readAll выполняет запрос на чтение и возвращает все записи результата.
+func readAll(ctx context.Context, session neo4j.SessionWithContext, query string, params map[string]any) ([]*neo4j.Record, error) {
+	records, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, query, params)
+		if err != nil {
+			return nil, err
+		}
+		return result.Collect(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records.([]*neo4j.Record), nil
+}
+
+func nodeDiffs(records []*neo4j.Record) []models.NodeDiff {
+	var nodes []models.NodeDiff
+	for _, record := range records {
+		values := record.AsMap()
+		nodes = append(nodes, models.NodeDiff{
+			Label: asString(values["label"]),
+			ID:    asInt64(values["id"]),
+			Name:  asString(values["name"]),
+		})
+	}
+	return nodes
+}
+
+func asString(value any) string {
+	s, _ := value.(string)
+	return s
+}
+
+func asInt64(value any) int64 {
+	n, _ := value.(int64)
+	return n
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sirupsen/logrus"
+)
+
+// Migration — версионированный шаг изменения схемы или данных графа.
+// Statements выполняются по порядку, каждый в отдельной транзакции:
+// изменения схемы нельзя смешивать в одной транзакции с записью данных.
+type Migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// migrations — все шаги по возрастанию версии. Применённый шаг менять нельзя,
+// изменения добавляются новым шагом в конец списка.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "merge duplicate :User and :Group nodes; uniqueness constraints on :User(id) and :Group(id)",
+		// Графы, собранные одновременными запусками без ограничений, содержат дубликаты
+		// узлов с одним id, на которых создание ограничения падает. Сначала они сливаются.
+		Statements: slices.Concat(
+			dedupStatements("User"),
+			dedupStatements("Group"),
+			[]string{
+				`CREATE CONSTRAINT user_id_unique IF NOT EXISTS FOR (u:User) REQUIRE u.id IS UNIQUE`,
+				`CREATE CONSTRAINT group_id_unique IF NOT EXISTS FOR (g:Group) REQUIRE g.id IS UNIQUE`,
+			},
+		),
+	},
+	{
+		Version:     2,
+		Description: "indexes on screen_name and city",
+		Statements: []string{
+			`CREATE INDEX user_screen_name IF NOT EXISTS FOR (u:User) ON (u.screen_name)`,
+			`CREATE INDEX user_city IF NOT EXISTS FOR (u:User) ON (u.city)`,
+			`CREATE INDEX group_screen_name IF NOT EXISTS FOR (g:Group) ON (g.screen_name)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "rewrite user-to-user SUBSCRIBES edges as FOLLOWS",
+		Statements: []string{
+			`MATCH (a:User)-[r:SUBSCRIBES]->(b:User)
+			MERGE (a)-[:FOLLOWS]->(b)
+			DELETE r`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "uniqueness constraint on :CrawlRun(id)",
+		Statements: []string{
+			`CREATE CONSTRAINT crawl_run_id_unique IF NOT EXISTS FOR (r:CrawlRun) REQUIRE r.id IS UNIQUE`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "relationship validity intervals: backfill valid_from from first_seen",
+		Statements: []string{
+			// Связи, записанные до появления first_seen, остаются без valid_from:
+			// момент их появления неизвестен, и они считаются действующими с начала истории.
+			`MATCH ()-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]->()
+			WHERE r.valid_from IS NULL AND r.first_seen IS NOT NULL
+			SET r.valid_from = r.first_seen`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "index :PropertyChange by time and node for snapshot diffs",
+		Statements: []string{
+			`CREATE INDEX property_change_changed_at IF NOT EXISTS FOR (c:PropertyChange) ON (c.changed_at)`,
+			`CREATE INDEX property_change_node IF NOT EXISTS FOR (c:PropertyChange) ON (c.label, c.node_id)`,
+		},
+	},
+}
+
+// duplicateNodes выбирает узлы метки %s с одинаковым id: keep остаётся, dups сливаются в него.
+const duplicateNodes = `
+	MATCH (n:%s)
+	WITH n.id AS id, collect(n) AS nodes
+	WHERE id IS NOT NULL AND size(nodes) > 1
+	WITH nodes[0] AS keep, nodes[1..] AS dups
+	UNWIND dups AS dup
+	WITH keep, dups, dup`
+
+// dedupStatements сливает дубликаты узлов метки label: связи каждого типа в обе стороны
+// переносятся на оставляемый узел (совпадающая связь с тем же valid_from не копируется),
+// недостающие свойства берутся у дубликатов, после чего дубликаты удаляются.
+func dedupStatements(label string) []string {
+	var statements []string
+	for _, relType := range []models.RelationshipType{models.RelFollows, models.RelSubscribes, models.RelFriends, models.RelMemberOf} {
+		for _, pattern := range [][2]string{{"(dup)-[r:%[1]s]->(other)", "(keep)-[k:%[1]s]->(other)"}, {"(other)-[r:%[1]s]->(dup)", "(other)-[k:%[1]s]->(keep)"}} {
+			from, to := fmt.Sprintf(pattern[0], relType), fmt.Sprintf(pattern[1], relType)
+			statements = append(statements, fmt.Sprintf(duplicateNodes, label)+`
+	MATCH `+from+`
+	WHERE other <> keep AND NOT other IN dups
+	WITH keep, other, r, properties(r) AS props,
+		EXISTS { MATCH `+strings.Replace(to, "[k:", "[e:", 1)+` WHERE e.valid_from = props.valid_from OR (e.valid_from IS NULL AND props.valid_from IS NULL) } AS known
+	FOREACH (_ IN CASE WHEN known THEN [] ELSE [1] END | CREATE `+to+` SET k = props)
+	DELETE r`)
+		}
+	}
+	return append(statements, fmt.Sprintf(duplicateNodes, label)+`
+	WITH keep, dup, properties(keep) AS kept
+	SET keep += properties(dup)
+	SET keep += kept
+	DETACH DELETE dup`)
+}
+
+// SchemaVersion возвращает версию последней применённой миграции (0, если миграций не было).
+// Применённые версии хранятся в графе узлами :SchemaMigration.
+func (s *Neo4jStorage) SchemaVersion(ctx context.Context) (int, error) {
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer func() {
+		if err := session.Close(ctx); err != nil {
+			logrus.Warnf("close session: %v", err)
+		}
+	}()
+
+	version, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		result, err := tx.Run(ctx, `
+			MATCH (m:SchemaMigration)
+			RETURN coalesce(max(m.version), 0) AS version
+		`, nil)
+		if err != nil {
+			return nil, err
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return nil, err
+		}
+		value, _ := record.Get("version")
+		return value, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	v, _ := version.(int64)
+	return int(v), nil
+}
+
+// PendingMigrations возвращает миграции, которые ещё не применены.
+func (s *Neo4jStorage) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// LatestSchemaVersion возвращает версию последней известной миграции.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate применяет все неприменённые миграции и возвращает их список.
+func (s *Neo4jStorage) Migrate(ctx context.Context) ([]Migration, error) {
+	pending, err := s.PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer func() {
+		if err := session.Close(ctx); err != nil {
+			logrus.Warnf("close session: %v", err)
+		}
+	}()
+
+	for _, m := range pending {
+		for _, statement := range m.Statements {
+			_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+				_, err := tx.Run(ctx, statement, nil)
+				return nil, err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("apply migration %d: %w", m.Version, err)
+			}
+		}
+
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			_, err := tx.Run(ctx, `
+				MERGE (m:SchemaMigration {version: $version})
+				SET m.description = $description, m.applied_at = datetime()
+			`, map[string]any{
+				"version":     m.Version,
+				"description": m.Description,
+			})
+			return nil, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"version":     m.Version,
+			"description": m.Description,
+		}).Info("Миграция применена")
+	}
+
+	return pending, nil
+}
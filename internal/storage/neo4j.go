@@ -3,13 +3,22 @@ package storage
 import (
 	"context"
 	"fmt"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/config"
 	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/queries"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
 type Neo4jStorage struct {
 	Driver neo4j.DriverWithContext
+	// BatchSize — число сущностей в одной пачке записи.
+	BatchSize int
+	// FlushInterval — как часто записывать неполную пачку при потоковой записи.
+	FlushInterval time.Duration
+	// Queries — каталог предопределённых запросов для RunQuery.
+	Queries *queries.Registry
 }
 
 func NewNeo4jStorage(uri, username, password string) *Neo4jStorage {
@@ -17,13 +26,20 @@ func NewNeo4jStorage(uri, username, password string) *Neo4jStorage {
 	if err != nil {
 		logrus.Fatalf("connect to driver: %v", err)
 	}
-	return &Neo4jStorage{Driver: driver}
+	return &Neo4jStorage{
+		Driver:        driver,
+		BatchSize:     config.DefaultBatchSize,
+		FlushInterval: config.DefaultFlushInterval,
+		Queries:       queries.Builtin(),
+	}
 }
 
 func (s *Neo4jStorage) Close(ctx context.Context) error {
 	return s.Driver.Close(ctx)
 }
 
+// SaveData записывает пользователей, группы, связи и сведения об исходных узлах
+// пачками по s.BatchSize строк: каждая пачка — один запрос UNWIND в отдельной транзакции записи.
 func (s *Neo4jStorage) SaveData(ctx context.Context, data *models.Data) error {
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
 	defer func(session neo4j.SessionWithContext, ctx context.Context) {
@@ -33,81 +49,196 @@ func (s *Neo4jStorage) SaveData(ctx context.Context, data *models.Data) error {
 		}
 	}(session, ctx)
 
+	// Наборы связей сверяются до записи связей пачки: иначе новые связи уже
+	// были бы в хранилище и не попали в сводку изменений.
+	if err := s.reconcile(ctx, session, data.RunID, data.EdgeSets); err != nil {
+		logrus.Errorf("reconcile edges: %v", err)
+		return fmt.Errorf("reconcile edges: %v", err)
+	}
+
+	users := make([]map[string]any, 0, len(data.Users))
+	var statuses []map[string]any
 	for _, user := range data.Users {
-		_, err := session.Run(
-			ctx,
-			`
-			MERGE (u:User {id: $id})
-			SET u.name = $name, u.screen_name = $screen_name, u.sex = $sex, u.city = $city
-			`,
-			map[string]interface{}{
-				"id":          user.ID,
-				"name":        user.Name,
-				"screen_name": user.ScreenName,
-				"sex":         user.Sex,
-				"city":        user.City,
-			},
-		)
-		if err != nil {
-			logrus.Errorf("save user %d: %v", user.ID, err)
-			return fmt.Errorf("save user %d: %v", user.ID, err)
+		if user.StatusOnly() {
+			statuses = append(statuses, map[string]any{"id": user.ID, "status": string(user.Status)})
+			continue
 		}
+		users = append(users, map[string]any{
+			"id":              user.ID,
+			"name":            user.Name,
+			"screen_name":     user.ScreenName,
+			"sex":             user.Sex,
+			"city":            user.City,
+			"bdate":           nullIfZero(user.BirthDate),
+			"country":         nullIfZero(user.Country),
+			"followers_count": user.FollowersCount,
+			"is_closed":       user.IsClosed,
+			"deactivated":     nullIfZero(user.Deactivated),
+			"last_online":     nullIfZeroTime(user.LastSeen),
+			"verified":        user.Verified,
+			"photo_200":       nullIfZero(user.Photo),
+			"university":      nullIfZero(user.University),
+			"faculty":         nullIfZero(user.Faculty),
+			"graduation":      nullIfZero(user.Graduation),
+			"occupation_type": nullIfZero(user.OccupationType),
+			"occupation_name": nullIfZero(user.OccupationName),
+			"status":          nullIfZero(user.Status),
+		})
+	}
+	if err := s.writeBatches(ctx, session, saveUsersQuery, data.RunID, users); err != nil {
+		logrus.Errorf("save users: %v", err)
+		return fmt.Errorf("save users: %v", err)
+	}
+	if err := s.writeBatches(ctx, session, saveUserStatusesQuery, data.RunID, statuses); err != nil {
+		logrus.Errorf("save user statuses: %v", err)
+		return fmt.Errorf("save user statuses: %v", err)
 	}
 
+	groups := make([]map[string]any, 0, len(data.Groups))
 	for _, group := range data.Groups {
-		_, err := session.Run(
-			ctx,
-			`
-			MERGE (g:Group {id: $id})
-			SET g.name = $name, g.screen_name = $screen_name
-			`,
-			map[string]interface{}{
-				"id":          group.ID,
-				"name":        group.Name,
-				"screen_name": group.ScreenName,
-			},
-		)
-		if err != nil {
-			logrus.Errorf("save group %d: %v", group.ID, err)
-			return fmt.Errorf("save group %d: %v", group.ID, err)
-		}
+		groups = append(groups, map[string]any{
+			"id":            group.ID,
+			"name":          group.Name,
+			"screen_name":   group.ScreenName,
+			"members_count": nullIfZero(group.MembersCount),
+			"activity":      nullIfZero(group.Activity),
+			"type":          nullIfZero(group.Type),
+			"is_closed":     group.IsClosed,
+			"verified":      group.Verified,
+			"city":          nullIfZero(group.City),
+			"description":   nullIfZero(group.Description),
+			"site":          nullIfZero(group.Site),
+		})
+	}
+	if err := s.writeBatches(ctx, session, saveGroupsQuery, data.RunID, groups); err != nil {
+		logrus.Errorf("save groups: %v", err)
+		return fmt.Errorf("save groups: %v", err)
 	}
 
+	// Связи группируются по типу и видам концов: у каждой группы свой запрос.
+	// Метки и тип связи подставляются в запрос только после проверки по белому списку.
+	type relKind struct {
+		relType          models.RelationshipType
+		fromKind, toKind models.NodeKind
+	}
+	rels := make(map[relKind][]map[string]any)
 	for _, rel := range data.Relationships {
-		fromLabel, toLabel := "User", "User"
-		fromID, toID := rel.From, rel.To
+		if !rel.Type.Valid() || !rel.From.Kind.Valid() || !rel.To.Kind.Valid() {
+			return fmt.Errorf("save relationship %s -> %s: unsupported relationship %q", rel.From, rel.To, rel.Type)
+		}
+		kind := relKind{relType: rel.Type, fromKind: rel.From.Kind, toKind: rel.To.Kind}
+		rels[kind] = append(rels[kind], map[string]any{
+			"from_id": rel.From.ID,
+			"to_id":   rel.To.ID,
+		})
+	}
+	for kind, rows := range rels {
+		query := fmt.Sprintf(saveRelationshipsQuery, kind.fromKind, kind.toKind, kind.relType)
+		if err := s.writeBatches(ctx, session, query, data.RunID, rows); err != nil {
+			logrus.Errorf("save relationships %s: %v", kind.relType, err)
+			return fmt.Errorf("save relationships %s: %v", kind.relType, err)
+		}
+	}
 
-		if rel.To < 0 {
-			toLabel = "Group"
-			toID = -rel.To
+	reach := make(map[models.NodeKind][]map[string]any)
+	for node, seeds := range data.Reach {
+		if !node.Kind.Valid() {
+			return fmt.Errorf("save reach %s: unsupported node kind", node)
+		}
+		seedIDs := make([]string, len(seeds))
+		distances := make([]int, len(seeds))
+		for i, seed := range seeds {
+			seedIDs[i] = seed.Seed.String()
+			distances[i] = seed.Distance
 		}
+		reach[node.Kind] = append(reach[node.Kind], map[string]any{
+			"id":             node.ID,
+			"seed_ids":       seedIDs,
+			"seed_distances": distances,
+		})
+	}
+	for kind, rows := range reach {
+		if err := s.writeBatches(ctx, session, fmt.Sprintf(saveReachQuery, kind), data.RunID, rows); err != nil {
+			logrus.Errorf("save reach %s: %v", kind, err)
+			return fmt.Errorf("save reach %s: %v", kind, err)
+		}
+	}
 
-		_, err := session.Run(
-			ctx,
-			fmt.Sprintf(`
-			MATCH (from:%s {id: $from_id})
-			MATCH (to:%s {id: $to_id})
-			MERGE (from)-[:%s]->(to)
-			`, fromLabel, toLabel, rel.Type),
-			map[string]interface{}{
-				"from_id": fromID,
-				"to_id":   toID,
-			},
-		)
+	return nil
+}
+
+// nullIfZero возвращает nil для нулевого значения: SET со значением null удаляет
+// свойство, и в графе не остаётся пустых строк и нулей вместо отсутствующих данных.
+func nullIfZero[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
+	}
+	return value
+}
+
+func nullIfZeroTime(value time.Time) any {
+	if value.IsZero() {
+		return nil
+	}
+	return value
+}
+
+// writeBatches выполняет query для rows пачками по s.BatchSize, передавая пачку в параметре $rows,
+// а запуск обхода — в параметре $run_id (null, если запуск не задан).
+func (s *Neo4jStorage) writeBatches(ctx context.Context, session neo4j.SessionWithContext, query, runID string, rows []map[string]any) error {
+	size := s.BatchSize
+	if size < 1 {
+		size = len(rows)
+	}
+	for start := 0; start < len(rows); start += size {
+		batch := rows[start:min(start+size, len(rows))]
+		_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			_, err := tx.Run(ctx, query, map[string]any{"rows": batch, "run_id": nullIfZero(runID)})
+			return nil, err
+		})
 		if err != nil {
-			logrus.Errorf("save relationship %s and %d и %d: %v", rel.Type, rel.From, rel.To, err)
-			return fmt.Errorf("save relationship %s and %d и %d: %v", rel.Type, rel.From, rel.To, err)
+			return err
 		}
 	}
-
 	return nil
 }
 
-func (s *Neo4jStorage) RunQuery(ctx context.Context, queryName string) ([]map[string]interface{}, error) {
-	query, exists := neo4jQueries[queryName]
+// collectBatches выполняет query так же, как writeBatches, и возвращает записи результата всех пачек.
+func (s *Neo4jStorage) collectBatches(ctx context.Context, session neo4j.SessionWithContext, query, runID string, rows []map[string]any) ([]*neo4j.Record, error) {
+	size := s.BatchSize
+	if size < 1 {
+		size = len(rows)
+	}
+	var records []*neo4j.Record
+	for start := 0; start < len(rows); start += size {
+		batch := rows[start:min(start+size, len(rows))]
+		result, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+			result, err := tx.Run(ctx, query, map[string]any{"rows": batch, "run_id": nullIfZero(runID)})
+			if err != nil {
+				return nil, err
+			}
+			return result.Collect(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, result.([]*neo4j.Record)...)
+	}
+	return records, nil
+}
+
+// RunQuery выполняет предопределённый запрос с параметрами, переданными строками:
+// значения проверяются и приводятся к типам из описания запроса.
+func (s *Neo4jStorage) RunQuery(ctx context.Context, queryName string, values map[string]string) ([]map[string]interface{}, error) {
+	query, exists := s.Queries.Get(queryName)
 	if !exists {
 		return nil, fmt.Errorf("query %s not found", queryName)
 	}
+	params, err := query.Bind(values)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", queryName, err)
+	}
 
 	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
 	defer func(session neo4j.SessionWithContext, ctx context.Context) {
@@ -117,7 +248,7 @@ func (s *Neo4jStorage) RunQuery(ctx context.Context, queryName string) ([]map[st
 		}
 	}(session, ctx)
 
-	result, err := session.Run(ctx, query, nil)
+	result, err := session.Run(ctx, query.Cypher, params)
 	if err != nil {
 		return nil, err
 	}
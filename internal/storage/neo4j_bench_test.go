@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// fakeRoundTrip имитирует сетевую задержку одного запроса к Neo4j.
+const fakeRoundTrip = 200 * time.Microsecond
+
+// fakeDriver — драйвер в памяти процесса, который считает и запоминает запросы.
+// Встроенные интерфейсы дают остальные методы; вызывать их в тестах нельзя.
+type fakeDriver struct {
+	neo4j.DriverWithContext
+	runs int
+	rows int
+	// queries — тексты выполненных запросов по порядку, params — их параметры.
+	queries []string
+	params  []map[string]any
+	// results, если задан, возвращает записи результата запроса; по умолчанию результат пуст.
+	results func(query string, params map[string]any) []*neo4j.Record
+}
+
+func (d *fakeDriver) NewSession(context.Context, neo4j.SessionConfig) neo4j.SessionWithContext {
+	return &fakeSession{driver: d}
+}
+
+type fakeSession struct {
+	neo4j.SessionWithContext
+	driver *fakeDriver
+}
+
+func (s *fakeSession) ExecuteWrite(ctx context.Context, work neo4j.ManagedTransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	return work(&fakeTx{driver: s.driver})
+}
+
+func (s *fakeSession) Close(context.Context) error {
+	return nil
+}
+
+type fakeTx struct {
+	neo4j.ManagedTransaction
+	driver *fakeDriver
+}
+
+func (tx *fakeTx) Run(_ context.Context, query string, params map[string]any) (neo4j.ResultWithContext, error) {
+	time.Sleep(fakeRoundTrip)
+	tx.driver.runs++
+	if rows, ok := params["rows"].([]map[string]any); ok {
+		tx.driver.rows += len(rows)
+	}
+	tx.driver.queries = append(tx.driver.queries, query)
+	tx.driver.params = append(tx.driver.params, params)
+	result := &fakeResult{}
+	if tx.driver.results != nil {
+		result.records = tx.driver.results(query, params)
+	}
+	return result, nil
+}
+
+// fakeResult отдаёт заранее заданные записи.
+type fakeResult struct {
+	neo4j.ResultWithContext
+	records []*neo4j.Record
+}
+
+func (r *fakeResult) Collect(context.Context) ([]*neo4j.Record, error) {
+	return r.records, nil
+}
+
+func benchmarkData(users, groups int) *models.Data {
+	data := &models.Data{
+		Users:  make(map[int]models.User, users),
+		Groups: make(map[int]models.Group, groups),
+	}
+	for i := 1; i <= users; i++ {
+		data.Users[i] = models.User{ID: i, Name: fmt.Sprintf("User %d", i), City: "Moscow"}
+		data.Relationships = append(data.Relationships,
+			models.Relationship{From: models.UserRef(i), To: models.UserRef(i%users + 1), Type: models.RelFollows},
+			models.Relationship{From: models.UserRef(i), To: models.GroupRef(i%groups + 1), Type: models.RelSubscribes},
+		)
+	}
+	for i := 1; i <= groups; i++ {
+		data.Groups[i] = models.Group{ID: i, Name: fmt.Sprintf("Group %d", i)}
+	}
+	return data
+}
+
+// BenchmarkSaveData сравнивает запись по одной строке (как до UNWIND) с пачками.
+func BenchmarkSaveData(b *testing.B) {
+	data := benchmarkData(2000, 200)
+	for _, batchSize := range []int{1, 100, 500} {
+		b.Run(fmt.Sprintf("batch_%d", batchSize), func(b *testing.B) {
+			driver := &fakeDriver{}
+			s := &Neo4jStorage{Driver: driver, BatchSize: batchSize}
+			for i := 0; i < b.N; i++ {
+				if err := s.SaveData(context.Background(), data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(driver.runs)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -1,58 +1,201 @@
 package storage
 
-var neo4jQueries = map[string]string{
-	// всего пользователей
-	"total_users": `
-			MATCH (u:User)
-			RETURN COUNT(u) AS total_users
-		`,
-	// всего групп
-	"total_groups": `
-			MATCH (g:Group)
-			RETURN COUNT(g) AS total_groups
-		`,
-	// топ 5 пользователей по количеству фоллоуверов
-	"top_users": `
-			MATCH (u:User)<-[:FOLLOWS]-(f:User)
-			RETURN u.id AS user_id, COUNT(f) AS followers_count
-			ORDER BY followers_count DESC
-			LIMIT 5
-		`,
-	//  топ 5 самых популярных групп
-	"top_groups": `
-			MATCH (g:Group)<-[:SUBSCRIBES]-(u:User)
-			RETURN g.name AS group_name, COUNT(u) AS subscribers_count
-			ORDER BY subscribers_count DESC
-			LIMIT 5
-		`,
-	//  все пользователи, которые фолоуверы друг друга.
-	"mutual_followers": `
-			MATCH (u1:User)-[:FOLLOWS]->(u2:User)
-			MATCH (u2)-[:FOLLOWS]->(u1)
-			RETURN u1.id AS user1_id, u2.id AS user2_id
-		`,
-	// Топ-5 пользователей по количеству подписок на группы
-	"top_subscribers": `
-		MATCH (u:User)-[:SUBSCRIBES]->(g:Group)
-		RETURN u.id AS user_id, COUNT(g) AS subscription_count
-		ORDER BY subscription_count DESC
-		LIMIT 5
-	`,
-	// Топ-5 популярных городов среди пользователей
-	"top_cities": `
-		MATCH (u:User)
-		WHERE u.city IS NOT NULL
-		RETURN u.city AS city, COUNT(u) AS user_count
-		ORDER BY user_count DESC
-		LIMIT 5
-	`,
-	// Пользователи с наибольшим количеством общих подписчиков с другими пользователями
-	"top_mutual_followers": `
-		MATCH (u1:User)<-[:FOLLOWS]-(mutualFollower)-[:FOLLOWS]->(u2:User)
-		WHERE u1 <> u2
-		WITH u1, COUNT(DISTINCT mutualFollower) AS mutual_followers_count
-		RETURN u1.id AS user_id, mutual_followers_count
-		ORDER BY mutual_followers_count DESC
-		LIMIT 5
-	`,
-}
+// Запросы записи отмечают каждый затронутый узел и связь: first_seen — когда они впервые
+// попали в граф, last_seen — когда были записаны последний раз, last_run_id — в каком
+// запуске обхода (параметр $run_id). Время последнего визита пользователя в VK хранится
+// в свойстве last_online.
+//
+// Связь хранит интервал действия [valid_from, valid_to): исчезнувшая связь не удаляется, а
+// закрывается (valid_to и closed_run_id — запуск, в котором её не стало), повторно появившаяся
+// создаётся заново. Открытая связь (valid_to IS NULL) описывает текущее состояние; у связей,
+// записанных до появления интервалов, valid_from может отсутствовать — они считаются
+// действующими с начала истории.
+//
+// Изменение отслеживаемого свойства узла (имя, город и т. п.) записывается узлом
+// :PropertyChange {label, node_id, property, old_value, new_value, changed_at, run_id}.
+// Свойство, которого у узла ещё не было, изменением не считается.
+
+const saveUsersQuery = `
+	UNWIND $rows AS row
+	MERGE (u:User {id: row.id})
+	ON CREATE SET u.first_seen = datetime()
+	WITH u, row
+	FOREACH (p IN [p IN ['name', 'screen_name', 'city', 'country', 'status', 'university', 'occupation_name']
+			WHERE u[p] IS NOT NULL AND (row[p] IS NULL OR u[p] <> row[p])] |
+		CREATE (:PropertyChange {label: 'User', node_id: u.id, property: p, old_value: u[p], new_value: row[p],
+			changed_at: datetime(), run_id: $run_id}))
+	SET u.name = row.name, u.screen_name = row.screen_name, u.sex = row.sex, u.city = row.city,
+		u.bdate = row.bdate, u.country = row.country, u.followers_count = row.followers_count,
+		u.is_closed = row.is_closed, u.deactivated = row.deactivated, u.last_online = row.last_online,
+		u.verified = row.verified, u.photo_200 = row.photo_200,
+		u.university = row.university, u.faculty = row.faculty, u.graduation = row.graduation,
+		u.occupation_type = row.occupation_type, u.occupation_name = row.occupation_name,
+		u.status = row.status,
+		u.last_seen = datetime(), u.last_run_id = $run_id
+`
+
+// saveUserStatusesQuery записывает пользователей, о которых известен только статус профиля
+// (User.StatusOnly): остальные сохранённые свойства узла не затираются.
+const saveUserStatusesQuery = `
+	UNWIND $rows AS row
+	MERGE (u:User {id: row.id})
+	ON CREATE SET u.first_seen = datetime()
+	WITH u, row
+	FOREACH (_ IN CASE WHEN u.status IS NOT NULL AND u.status <> row.status THEN [1] ELSE [] END |
+		CREATE (:PropertyChange {label: 'User', node_id: u.id, property: 'status', old_value: u.status,
+			new_value: row.status, changed_at: datetime(), run_id: $run_id}))
+	SET u.status = row.status, u.last_seen = datetime(), u.last_run_id = $run_id
+`
+
+const saveGroupsQuery = `
+	UNWIND $rows AS row
+	MERGE (g:Group {id: row.id})
+	ON CREATE SET g.first_seen = datetime()
+	WITH g, row
+	FOREACH (p IN [p IN ['name', 'screen_name', 'city', 'type', 'is_closed', 'site']
+			WHERE g[p] IS NOT NULL AND (row[p] IS NULL OR g[p] <> row[p])] |
+		CREATE (:PropertyChange {label: 'Group', node_id: g.id, property: p, old_value: g[p], new_value: row[p],
+			changed_at: datetime(), run_id: $run_id}))
+	SET g.name = row.name, g.screen_name = row.screen_name,
+		g.members_count = row.members_count, g.activity = row.activity, g.type = row.type,
+		g.is_closed = row.is_closed, g.verified = row.verified, g.city = row.city,
+		g.description = row.description, g.site = row.site,
+		g.last_seen = datetime(), g.last_run_id = $run_id
+`
+
+// saveRelationshipsQuery записывает связи одного типа между узлами заданных видов: продлевает
+// открытую связь или, если её нет, открывает новую с valid_from. Метки концов и тип связи
+// подставляются через fmt.Sprintf после проверки по белому списку.
+// Концы связи создаются при необходимости: при потоковой записи узел может
+// прийти в следующей пачке или не раскрываться вовсе (граница обхода).
+const saveRelationshipsQuery = `
+	UNWIND $rows AS row
+	MERGE (from:%[1]s {id: row.from_id})
+	ON CREATE SET from.first_seen = datetime()
+	MERGE (to:%[2]s {id: row.to_id})
+	ON CREATE SET to.first_seen = datetime()
+	SET from.last_seen = datetime(), from.last_run_id = $run_id,
+		to.last_seen = datetime(), to.last_run_id = $run_id
+	WITH DISTINCT from, to
+	OPTIONAL MATCH (from)-[open:%[3]s]->(to)
+	WHERE open.valid_to IS NULL
+	WITH from, to, head(collect(open)) AS open
+	FOREACH (_ IN CASE WHEN open IS NULL THEN [1] ELSE [] END |
+		CREATE (from)-[:%[3]s {first_seen: datetime(), valid_from: datetime(),
+			last_seen: datetime(), last_run_id: $run_id}]->(to))
+	FOREACH (_ IN CASE WHEN open IS NULL THEN [] ELSE [1] END |
+		SET open.last_seen = datetime(), open.last_run_id = $run_id)
+`
+
+// saveReachQuery записывает, от каких исходных узлов и на каком расстоянии обход дошёл до узла:
+// seed_ids[i] — исходный узел вида User:1 или Group:1, seed_distances[i] — расстояние до него.
+// Метка узла подставляется через fmt.Sprintf после проверки NodeKind.Valid.
+const saveReachQuery = `
+	UNWIND $rows AS row
+	MERGE (n:%s {id: row.id})
+	ON CREATE SET n.first_seen = datetime()
+	SET n.seed_ids = row.seed_ids, n.seed_distances = row.seed_distances,
+		n.last_seen = datetime(), n.last_run_id = $run_id
+`
+
+// gainedEdgesQuery возвращает ID соседей из полного набора связей, открытых связей с которыми нет в хранилище.
+// Подставляются метка владельца, шаблон связи с переменной r и метка соседа. Владельцы, впервые попавшие
+// в граф в текущем запуске, пропускаются: для них все связи новые, и сводка изменений не нужна.
+const gainedEdgesQuery = `
+	UNWIND $rows AS row
+	MATCH (run:CrawlRun {id: $run_id})
+	MATCH (owner:%s {id: row.owner})
+	WHERE owner.first_seen IS NULL OR owner.first_seen < run.started_at
+	UNWIND row.ids AS id
+	WITH row, owner, id
+	WHERE NOT EXISTS { MATCH (owner)%s(:%s {id: id}) WHERE r.valid_to IS NULL }
+	RETURN row.owner AS owner, collect(id) AS ids
+`
+
+// closeLostEdgesQuery закрывает открытые связи владельца, которых нет в полном наборе,
+// и возвращает ID соседей закрытых связей. Подставляются метка владельца, шаблон связи
+// с переменной r и метка соседа.
+const closeLostEdgesQuery = `
+	UNWIND $rows AS row
+	MATCH (owner:%s {id: row.owner})%s(other:%s)
+	WHERE r.valid_to IS NULL AND NOT other.id IN row.ids
+	SET r.valid_to = datetime(), r.closed_run_id = $run_id
+	RETURN row.owner AS owner, collect(other.id) AS ids
+`
+
+// startRunQuery создаёт узел запуска обхода.
+const startRunQuery = `
+	CREATE (r:CrawlRun {id: $id})
+	SET r.seeds = $seeds, r.depth = $depth, r.options = $options,
+		r.started_at = datetime(), r.outcome = $outcome
+`
+
+// finishRunQuery записывает итог запуска обхода.
+const finishRunQuery = `
+	MATCH (r:CrawlRun {id: $id})
+	SET r.finished_at = datetime(), r.outcome = $outcome, r.error = $error,
+		r.requests = $requests, r.expanded = $expanded,
+		r.private = $private, r.deleted = $deleted, r.banned = $banned, r.failed = $failed,
+		r.exhausted = $exhausted
+`
+
+// findRunQuery находит запуск обхода по идентификатору.
+const findRunQuery = `
+	MATCH (r:CrawlRun {id: $id})
+	RETURN r.id AS id, r.finished_at AS finished_at
+`
+
+// findRunBeforeQuery находит последний запуск обхода, завершившийся не позже $at.
+const findRunBeforeQuery = `
+	MATCH (r:CrawlRun)
+	WHERE r.finished_at <= $at
+	RETURN r.id AS id, r.finished_at AS finished_at
+	ORDER BY r.finished_at DESC
+	LIMIT 1
+`
+
+// Запросы сравнения графа на моменты $from и $to. Связь действовала в момент t,
+// если valid_from не позже t, а valid_to позже t (см. запросы _as_of). Связи одного типа
+// между одними узлами сравниваются вместе: закрытая и снова открытая связь не считается изменением.
+
+// diffAddedNodesQuery находит узлы, впервые попавшие в граф после $from.
+const diffAddedNodesQuery = `
+	MATCH (n)
+	WHERE (n:User OR n:Group) AND n.first_seen > $from AND n.first_seen <= $to
+	RETURN labels(n)[0] AS label, n.id AS id, n.name AS name
+	ORDER BY label, id
+`
+
+// diffRemovedNodesQuery находит узлы, у которых в момент $from были действующие связи, а в $to — нет.
+const diffRemovedNodesQuery = `
+	MATCH (n)-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]-()
+	WHERE n:User OR n:Group
+	WITH n, collect(r) AS rels
+	WITH n,
+		any(r IN rels WHERE (r.valid_from IS NULL OR r.valid_from <= $from) AND (r.valid_to IS NULL OR r.valid_to > $from)) AS before,
+		any(r IN rels WHERE (r.valid_from IS NULL OR r.valid_from <= $to) AND (r.valid_to IS NULL OR r.valid_to > $to)) AS after
+	WHERE before AND NOT after
+	RETURN labels(n)[0] AS label, n.id AS id, n.name AS name
+	ORDER BY label, id
+`
+
+// diffEdgesQuery находит связи, действовавшие только в один из моментов; added — действует в $to.
+const diffEdgesQuery = `
+	MATCH (a)-[r:FOLLOWS|SUBSCRIBES|FRIENDS|MEMBER_OF]->(b)
+	WITH a, b, type(r) AS type, collect(r) AS rels
+	WITH a, b, type,
+		any(r IN rels WHERE (r.valid_from IS NULL OR r.valid_from <= $from) AND (r.valid_to IS NULL OR r.valid_to > $from)) AS before,
+		any(r IN rels WHERE (r.valid_from IS NULL OR r.valid_from <= $to) AND (r.valid_to IS NULL OR r.valid_to > $to)) AS after
+	WHERE before <> after
+	RETURN type, labels(a)[0] AS from_label, a.id AS from_id, labels(b)[0] AS to_label, b.id AS to_id, after AS added
+	ORDER BY type, from_id, to_id
+`
+
+// diffPropertiesQuery находит изменения свойств узлов между $from и $to.
+const diffPropertiesQuery = `
+	MATCH (c:PropertyChange)
+	WHERE c.changed_at > $from AND c.changed_at <= $to
+	RETURN c.label AS label, c.node_id AS id, c.property AS property,
+		c.old_value AS old_value, c.new_value AS new_value, c.changed_at AS changed_at
+	ORDER BY changed_at, label, id
+`
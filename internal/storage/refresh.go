@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sirupsen/logrus"
+)
+
+// edgeSetKind — вид набора связей: у каждого вида свои запросы сверки.
+type edgeSetKind struct {
+	relType      models.RelationshipType
+	direction    models.EdgeDirection
+	owner, other models.NodeKind
+}
+
+// pattern возвращает шаблон связи с переменной r для подстановки в запрос между владельцем и соседом.
+func (k edgeSetKind) pattern() string {
+	switch k.direction {
+	case models.DirectionIn:
+		return fmt.Sprintf("<-[r:%s]-", k.relType)
+	case models.DirectionBoth:
+		return fmt.Sprintf("-[r:%s]-", k.relType)
+	default:
+		return fmt.Sprintf("-[r:%s]->", k.relType)
+	}
+}
+
+// fields возвращает имена полей сводки изменений для новых и исчезнувших связей.
+func (k edgeSetKind) fields() (gained, lost string) {
+	switch {
+	case k.relType == models.RelFriends:
+		return "friends_gained", "friends_lost"
+	case k.relType == models.RelFollows && k.direction == models.DirectionIn:
+		return "followers_gained", "followers_lost"
+	case k.relType == models.RelFollows:
+		return "following_gained", "following_lost"
+	case k.relType == models.RelSubscribes:
+		return "groups_joined", "groups_left"
+	}
+	return string(k.relType) + "_gained", string(k.relType) + "_lost"
+}
+
+// reconcile сверяет полные наборы связей с хранилищем: закрывает открытые связи, которых
+// в наборе нет, и логирует по каждому владельцу, какие связи появились и исчезли.
+// Новые связи записывает SaveData вместе с остальными связями пачки.
+func (s *Neo4jStorage) reconcile(ctx context.Context, session neo4j.SessionWithContext, runID string, sets []models.EdgeSet) error {
+	if len(sets) == 0 {
+		return nil
+	}
+
+	rows := make(map[edgeSetKind][]map[string]any)
+	for _, set := range sets {
+		switch set.Direction {
+		case models.DirectionOut, models.DirectionIn, models.DirectionBoth:
+		default:
+			return fmt.Errorf("edge set %s: unsupported direction %q", set.Owner, set.Direction)
+		}
+		if !set.Type.Valid() || !set.Owner.Kind.Valid() || !set.Other.Valid() {
+			return fmt.Errorf("edge set %s: unsupported relationship %q", set.Owner, set.Type)
+		}
+		kind := edgeSetKind{relType: set.Type, direction: set.Direction, owner: set.Owner.Kind, other: set.Other}
+		ids := set.IDs
+		if ids == nil {
+			ids = []int{}
+		}
+		rows[kind] = append(rows[kind], map[string]any{"owner": set.Owner.ID, "ids": ids})
+	}
+
+	changes := make(map[int64]logrus.Fields)
+	record := func(records []*neo4j.Record, field string) {
+		for _, rec := range records {
+			owner, _ := rec.Get("owner")
+			ids, _ := rec.Get("ids")
+			ownerID, ok := owner.(int64)
+			if list, _ := ids.([]any); !ok || len(list) == 0 {
+				continue
+			}
+			if changes[ownerID] == nil {
+				changes[ownerID] = logrus.Fields{"user_id": ownerID}
+			}
+			changes[ownerID][field] = ids
+		}
+	}
+
+	for kind, kindRows := range rows {
+		gainedField, lostField := kind.fields()
+
+		gainedQuery := fmt.Sprintf(gainedEdgesQuery, kind.owner, kind.pattern(), kind.other)
+		gained, err := s.collectBatches(ctx, session, gainedQuery, runID, kindRows)
+		if err != nil {
+			return fmt.Errorf("find gained %s: %v", kind.relType, err)
+		}
+		record(gained, gainedField)
+
+		lostQuery := fmt.Sprintf(closeLostEdgesQuery, kind.owner, kind.pattern(), kind.other)
+		lost, err := s.collectBatches(ctx, session, lostQuery, runID, kindRows)
+		if err != nil {
+			return fmt.Errorf("close lost %s: %v", kind.relType, err)
+		}
+		record(lost, lostField)
+	}
+
+	for _, fields := range changes {
+		logrus.WithFields(fields).Info("Изменения связей пользователя")
+	}
+	return nil
+}
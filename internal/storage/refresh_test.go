@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+const changesMessage = "Изменения связей пользователя"
+
+func ownerRecord(owner int64, ids ...int64) *neo4j.Record {
+	list := make([]any, len(ids))
+	for i, id := range ids {
+		list[i] = id
+	}
+	return &neo4j.Record{Keys: []string{"owner", "ids"}, Values: []any{owner, list}}
+}
+
+func TestSaveDataReconcilesEdgeSets(t *testing.T) {
+	hook := test.NewGlobal()
+
+	tests := []struct {
+		name   string
+		set    models.EdgeSet
+		gained []*neo4j.Record
+		lost   []*neo4j.Record
+		// wantIDs — набор ID, переданный в запросы сверки, want — поля сводки изменений (nil — сводки нет).
+		wantIDs []int
+		want    logrus.Fields
+	}{
+		{
+			name:    "followers gained and lost",
+			set:     models.EdgeSet{Owner: models.UserRef(1), Type: models.RelFollows, Direction: models.DirectionIn, Other: models.NodeUser, IDs: []int{2, 3}},
+			gained:  []*neo4j.Record{ownerRecord(1, 3)},
+			lost:    []*neo4j.Record{ownerRecord(1, 4)},
+			wantIDs: []int{2, 3},
+			want:    logrus.Fields{"user_id": int64(1), "followers_gained": []any{int64(3)}, "followers_lost": []any{int64(4)}},
+		},
+		{
+			name:    "following lost",
+			set:     models.EdgeSet{Owner: models.UserRef(1), Type: models.RelFollows, Direction: models.DirectionOut, Other: models.NodeUser, IDs: []int{2}},
+			lost:    []*neo4j.Record{ownerRecord(1, 5, 6)},
+			wantIDs: []int{2},
+			want:    logrus.Fields{"user_id": int64(1), "following_lost": []any{int64(5), int64(6)}},
+		},
+		{
+			name:    "all friends lost",
+			set:     models.EdgeSet{Owner: models.UserRef(7), Type: models.RelFriends, Direction: models.DirectionBoth, Other: models.NodeUser},
+			lost:    []*neo4j.Record{ownerRecord(7, 2)},
+			wantIDs: []int{},
+			want:    logrus.Fields{"user_id": int64(7), "friends_lost": []any{int64(2)}},
+		},
+		{
+			name:    "groups joined",
+			set:     models.EdgeSet{Owner: models.UserRef(1), Type: models.RelSubscribes, Direction: models.DirectionOut, Other: models.NodeGroup, IDs: []int{10}},
+			gained:  []*neo4j.Record{ownerRecord(1, 10)},
+			wantIDs: []int{10},
+			want:    logrus.Fields{"user_id": int64(1), "groups_joined": []any{int64(10)}},
+		},
+		{
+			name:    "no changes",
+			set:     models.EdgeSet{Owner: models.UserRef(1), Type: models.RelFollows, Direction: models.DirectionIn, Other: models.NodeUser, IDs: []int{2}},
+			gained:  []*neo4j.Record{ownerRecord(1)},
+			lost:    []*neo4j.Record{ownerRecord(1)},
+			wantIDs: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+			kind := edgeSetKind{relType: tt.set.Type, direction: tt.set.Direction, owner: tt.set.Owner.Kind, other: tt.set.Other}
+			gainedQuery := fmt.Sprintf(gainedEdgesQuery, kind.owner, kind.pattern(), kind.other)
+			lostQuery := fmt.Sprintf(closeLostEdgesQuery, kind.owner, kind.pattern(), kind.other)
+
+			driver := &fakeDriver{results: func(query string, _ map[string]any) []*neo4j.Record {
+				switch query {
+				case gainedQuery:
+					return tt.gained
+				case lostQuery:
+					return tt.lost
+				}
+				return nil
+			}}
+			s := &Neo4jStorage{Driver: driver, BatchSize: 100}
+			data := newBatch("run-1")
+			data.EdgeSets = []models.EdgeSet{tt.set}
+			data.Relationships = []models.Relationship{{From: models.UserRef(1), To: models.UserRef(2), Type: models.RelFollows}}
+
+			if err := s.SaveData(context.Background(), data); err != nil {
+				t.Fatalf("SaveData: %v", err)
+			}
+
+			gainedAt := slices.Index(driver.queries, gainedQuery)
+			lostAt := slices.Index(driver.queries, lostQuery)
+			relQuery := fmt.Sprintf(saveRelationshipsQuery, models.NodeUser, models.NodeUser, models.RelFollows)
+			relAt := slices.Index(driver.queries, relQuery)
+			if gainedAt < 0 || lostAt < 0 || relAt < 0 {
+				t.Fatalf("queries not run: gained %d, lost %d, relationships %d", gainedAt, lostAt, relAt)
+			}
+			if gainedAt > relAt || lostAt > relAt {
+				t.Errorf("edge sets reconciled after relationships were written")
+			}
+
+			wantRows := []map[string]any{{"owner": tt.set.Owner.ID, "ids": tt.wantIDs}}
+			for _, at := range []int{gainedAt, lostAt} {
+				params := driver.params[at]
+				if !reflect.DeepEqual(params["rows"], wantRows) {
+					t.Errorf("rows = %v, want %v", params["rows"], wantRows)
+				}
+				if params["run_id"] != "run-1" {
+					t.Errorf("run_id = %v, want run-1", params["run_id"])
+				}
+			}
+
+			var got []logrus.Fields
+			for _, entry := range hook.AllEntries() {
+				if entry.Message == changesMessage {
+					got = append(got, entry.Data)
+				}
+			}
+			switch {
+			case tt.want == nil && len(got) > 0:
+				t.Errorf("unexpected changes: %v", got)
+			case tt.want != nil && (len(got) != 1 || !reflect.DeepEqual(got[0], tt.want)):
+				t.Errorf("changes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveDataRejectsInvalidEdgeSet(t *testing.T) {
+	tests := []struct {
+		name string
+		set  models.EdgeSet
+	}{
+		{"direction", models.EdgeSet{Owner: models.UserRef(1), Type: models.RelFollows, Direction: "sideways", Other: models.NodeUser}},
+		{"relationship", models.EdgeSet{Owner: models.UserRef(1), Type: "LIKES", Direction: models.DirectionOut, Other: models.NodeUser}},
+		{"other kind", models.EdgeSet{Owner: models.UserRef(1), Type: models.RelFollows, Direction: models.DirectionOut, Other: "Post"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver := &fakeDriver{}
+			s := &Neo4jStorage{Driver: driver, BatchSize: 100}
+			data := newBatch("run-1")
+			data.EdgeSets = []models.EdgeSet{tt.set}
+
+			if err := s.SaveData(context.Background(), data); err == nil {
+				t.Fatal("SaveData: expected error")
+			}
+			if len(driver.queries) > 0 {
+				t.Errorf("queries run for invalid edge set: %d", len(driver.queries))
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"github.com/sirupsen/logrus"
+)
+
+// StartRun создаёт узел :CrawlRun для запуска обхода. Время начала берётся на сервере Neo4j,
+// как и отметки last_seen, чтобы их можно было сравнивать.
+func (s *Neo4jStorage) StartRun(ctx context.Context, run models.CrawlRun) error {
+	seeds := make([]string, len(run.Seeds))
+	for i, seed := range run.Seeds {
+		seeds[i] = seed.String()
+	}
+	options, err := json.Marshal(run.Options)
+	if err != nil {
+		return fmt.Errorf("encode run options: %w", err)
+	}
+
+	return s.writeRun(ctx, startRunQuery, map[string]any{
+		"id":      run.ID,
+		"seeds":   seeds,
+		"depth":   run.Options.Depth,
+		"options": string(options),
+		"outcome": string(run.Outcome),
+	})
+}
+
+// FinishRun записывает время окончания, итог и статистику запуска обхода.
+func (s *Neo4jStorage) FinishRun(ctx context.Context, run models.CrawlRun) error {
+	return s.writeRun(ctx, finishRunQuery, map[string]any{
+		"id":        run.ID,
+		"outcome":   string(run.Outcome),
+		"error":     nullIfZero(run.Error),
+		"requests":  run.Stats.Requests,
+		"expanded":  run.Stats.Expanded,
+		"private":   run.Stats.Private,
+		"deleted":   run.Stats.Deleted,
+		"banned":    run.Stats.Banned,
+		"failed":    run.Stats.Failed,
+		"exhausted": nullIfZero(run.Stats.Exhausted),
+	})
+}
+
+func (s *Neo4jStorage) writeRun(ctx context.Context, query string, params map[string]any) error {
+	session := s.Driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeWrite})
+	defer func() {
+		if err := session.Close(ctx); err != nil {
+			logrus.Warnf("close session: %v", err)
+		}
+	}()
+
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		_, err := tx.Run(ctx, query, params)
+		return nil, err
+	})
+	if err != nil {
+		return fmt.Errorf("write crawl run %v: %w", params["id"], err)
+	}
+	return nil
+}
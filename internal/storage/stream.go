@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ZetoOfficial/vk-info-app-neo4j/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// flushTimeout ограничивает запись одной пачки, в том числе финальной после отмены сбора.
+const flushTimeout = time.Minute
+
+// streamItem — одна сущность в очереди на запись; заполнено ровно одно из полей
+// user, group, rel, reach, edgeSet и sync. sync — запрос записать всё принятое до него.
+type streamItem struct {
+	user    *models.User
+	group   *models.Group
+	rel     *models.Relationship
+	reach   *models.NodeRef
+	seeds   []models.SeedDistance
+	edgeSet *models.EdgeSet
+	sync    chan error
+}
+
+// streamWriter принимает сущности через ограниченную очередь и записывает их пачками
+// через SaveData. Пока очередь заполнена, методы Add* блокируются.
+type streamWriter struct {
+	storage       *Neo4jStorage
+	ctx           context.Context
+	runID         string
+	batchSize     int
+	flushInterval time.Duration
+
+	items chan streamItem
+	done  chan struct{}
+
+	closeOnce sync.Once
+	err       error
+	summary   models.WriteSummary
+}
+
+// NewStreamWriter запускает запись сущностей пачками по s.BatchSize не реже раза
+// в s.FlushInterval; записанное отмечается запуском обхода runID. Запись продолжается
+// и после отмены ctx, чтобы принятые сущности не потерялись; остановить её можно только через Close.
+func (s *Neo4jStorage) NewStreamWriter(ctx context.Context, runID string) models.StreamWriter {
+	batchSize := s.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	w := &streamWriter{
+		storage:       s,
+		ctx:           context.WithoutCancel(ctx),
+		runID:         runID,
+		batchSize:     batchSize,
+		flushInterval: s.FlushInterval,
+		items:         make(chan streamItem, 2*batchSize),
+		done:          make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+func (w *streamWriter) AddUser(ctx context.Context, user models.User) error {
+	return w.add(ctx, streamItem{user: &user})
+}
+
+func (w *streamWriter) AddGroup(ctx context.Context, group models.Group) error {
+	return w.add(ctx, streamItem{group: &group})
+}
+
+func (w *streamWriter) AddRelationship(ctx context.Context, rel models.Relationship) error {
+	return w.add(ctx, streamItem{rel: &rel})
+}
+
+func (w *streamWriter) AddReach(ctx context.Context, node models.NodeRef, seeds []models.SeedDistance) error {
+	return w.add(ctx, streamItem{reach: &node, seeds: seeds})
+}
+
+func (w *streamWriter) AddEdgeSet(ctx context.Context, set models.EdgeSet) error {
+	return w.add(ctx, streamItem{edgeSet: &set})
+}
+
+func (w *streamWriter) add(ctx context.Context, item streamItem) error {
+	select {
+	case w.items <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return fmt.Errorf("stream writer stopped: %w", w.err)
+	}
+}
+
+// Sync записывает всё принятое до вызова и дожидается подтверждения записи.
+func (w *streamWriter) Sync(ctx context.Context) error {
+	ack := make(chan error, 1)
+	if err := w.add(ctx, streamItem{sync: ack}); err != nil {
+		return err
+	}
+	select {
+	case err := <-ack:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return fmt.Errorf("stream writer stopped: %w", w.err)
+	}
+}
+
+// Close записывает всё принятое и возвращает итог записи.
+func (w *streamWriter) Close() (models.WriteSummary, error) {
+	w.closeOnce.Do(func() {
+		close(w.items)
+	})
+	<-w.done
+	return w.summary, w.err
+}
+
+func (w *streamWriter) loop() {
+	defer close(w.done)
+
+	batch := newBatch(w.runID)
+	size := 0
+
+	var tick <-chan time.Time
+	if w.flushInterval > 0 {
+		ticker := time.NewTicker(w.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	flush := func() bool {
+		if size == 0 {
+			return true
+		}
+		if err := w.flush(batch); err != nil {
+			w.err = err
+			return false
+		}
+		batch = newBatch(w.runID)
+		size = 0
+		return true
+	}
+
+	for {
+		select {
+		case item, ok := <-w.items:
+			if !ok {
+				flush()
+				return
+			}
+			if item.sync != nil {
+				if !flush() {
+					item.sync <- w.err
+					return
+				}
+				item.sync <- nil
+				continue
+			}
+			switch {
+			case item.user != nil:
+				batch.Users[item.user.ID] = *item.user
+			case item.group != nil:
+				batch.Groups[item.group.ID] = *item.group
+			case item.rel != nil:
+				batch.Relationships = append(batch.Relationships, *item.rel)
+			case item.reach != nil:
+				batch.Reach[*item.reach] = item.seeds
+			case item.edgeSet != nil:
+				batch.EdgeSets = append(batch.EdgeSets, *item.edgeSet)
+			}
+			size++
+			if size >= w.batchSize && !flush() {
+				return
+			}
+		case <-tick:
+			if !flush() {
+				return
+			}
+		}
+	}
+}
+
+func (w *streamWriter) flush(batch *models.Data) error {
+	ctx, cancel := context.WithTimeout(w.ctx, flushTimeout)
+	defer cancel()
+
+	if err := w.storage.SaveData(ctx, batch); err != nil {
+		logrus.Errorf("Ошибка записи пачки в Neo4j: %v", err)
+		return fmt.Errorf("flush batch: %w", err)
+	}
+
+	w.summary.Users += len(batch.Users)
+	w.summary.Groups += len(batch.Groups)
+	w.summary.Relationships += len(batch.Relationships)
+	w.summary.Batches++
+	logrus.WithFields(logrus.Fields{
+		"users":         len(batch.Users),
+		"groups":        len(batch.Groups),
+		"relationships": len(batch.Relationships),
+	}).Debug("Пачка записана в Neo4j")
+	return nil
+}
+
+func newBatch(runID string) *models.Data {
+	return &models.Data{
+		RunID:         runID,
+		Users:         make(map[int]models.User),
+		Groups:        make(map[int]models.Group),
+		Relationships: []models.Relationship{},
+		Reach:         make(map[models.NodeRef][]models.SeedDistance),
+	}
+}